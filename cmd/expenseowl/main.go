@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/tanq16/expenseowl/internal/api"
 	"github.com/tanq16/expenseowl/internal/storage"
@@ -45,6 +46,19 @@ func runServer() {
 	http.HandleFunc("/table", handler.ServeTableView)
 	http.HandleFunc("/settings", handler.ServeSettingsPage)
 
+	// Authentication
+	http.HandleFunc("/login", handler.ServeLoginPage) // GET for page, POST to sign in
+	http.HandleFunc("/setup", handler.Setup)          // POST to create the first admin
+	http.HandleFunc("/logout", handler.Logout)        // POST
+	http.HandleFunc("/auth/status", handler.GetAuthStatus)
+	http.HandleFunc("/users", handler.GetUsers)               // GET all (admin)
+	http.HandleFunc("/user", handler.AddUser)                 // PUT for add (admin)
+	http.HandleFunc("/user/delete", handler.DeleteUser)       // DELETE (admin)
+	http.HandleFunc("/user/password", handler.UpdatePassword) // PUT for own password
+	http.HandleFunc("/tokens", handler.GetAPITokens)          // GET own tokens
+	http.HandleFunc("/token", handler.AddAPIToken)            // PUT for add
+	http.HandleFunc("/token/delete", handler.DeleteAPIToken)  // DELETE to revoke
+
 	// Static File Handlers
 	http.HandleFunc("/functions.js", handler.ServeStaticFile)
 	http.HandleFunc("/manifest.json", handler.ServeStaticFile)
@@ -56,23 +70,44 @@ func runServer() {
 	http.HandleFunc("/fa.min.css", handler.ServeStaticFile)
 	http.HandleFunc("/webfonts/", handler.ServeStaticFile)
 
+	// Ledgers
+	http.HandleFunc("/ledgers", handler.GetLedgers)         // GET accessible ledgers
+	http.HandleFunc("/ledger", handler.AddLedger)           // PUT for add
+	http.HandleFunc("/ledger/edit", handler.UpdateLedger)   // PUT for edit (owner)
+	http.HandleFunc("/ledger/delete", handler.DeleteLedger) // DELETE (owner)
+
 	// Config
 	http.HandleFunc("/config", handler.GetConfig)
 	http.HandleFunc("/categories", handler.GetCategories)
 	http.HandleFunc("/categories/edit", handler.UpdateCategories)
+	http.HandleFunc("/category/rename", handler.RenameCategory) // PUT {"from","to"}
+	http.HandleFunc("/category/merge", handler.MergeCategories) // PUT {"from","into"}
+	http.HandleFunc("/category/delete", handler.DeleteCategory) // DELETE ?name=&reassign=
 	http.HandleFunc("/currency", handler.GetCurrency)
 	http.HandleFunc("/currency/edit", handler.UpdateCurrency)
 	http.HandleFunc("/startdate", handler.GetStartDate)
 	http.HandleFunc("/startdate/edit", handler.UpdateStartDate)
-	// http.HandleFunc("/tags", handler.GetTags)
-	// http.HandleFunc("/tags/edit", handler.UpdateTags)
+	http.HandleFunc("/conversions", handler.GetConversions)
+	http.HandleFunc("/conversions/edit", handler.UpdateConversions)
+	http.HandleFunc("/rates", handler.GetExchangeRates)
+	http.HandleFunc("/rates/edit", handler.AddExchangeRates)
+	http.HandleFunc("/rates/delete", handler.DeleteExchangeRate)
+	http.HandleFunc("/tags", handler.GetTags)         // GET all with usage counts
+	http.HandleFunc("/tags/edit", handler.UpdateTags) // PUT the registry, for colors and order
+	http.HandleFunc("/tag/rename", handler.RenameTag) // PUT {"from","to"}
+	http.HandleFunc("/tag/merge", handler.MergeTags)  // PUT {"from","into"}
+	http.HandleFunc("/tag/delete", handler.DeleteTag) // DELETE, strips it from expenses
 
 	// Expenses
 	http.HandleFunc("/expense", handler.AddExpense)                     // PUT for add
 	http.HandleFunc("/expenses", handler.GetExpenses)                   // GET all
+	http.HandleFunc("/expenses/query", handler.QueryExpenses)           // GET filtered page
 	http.HandleFunc("/expense/edit", handler.EditExpense)               // PUT for edit
 	http.HandleFunc("/expense/delete", handler.DeleteExpense)           // DELETE for single
 	http.HandleFunc("/expenses/delete", handler.DeleteMultipleExpenses) // DELETE for multiple
+	http.HandleFunc("/expenses/duplicates", handler.GetDuplicates)      // GET likely duplicate pairs
+	http.HandleFunc("/expenses/merge", handler.MergeExpenses)           // PUT {"keep":id,"remove":id}
+	http.HandleFunc("/suggest", handler.GetSuggestion)                  // GET ?name= for category and tags
 
 	// Recurring Expenses
 	http.HandleFunc("/recurring-expense", handler.AddRecurringExpense)           // PUT for add
@@ -80,17 +115,52 @@ func runServer() {
 	http.HandleFunc("/recurring-expense/edit", handler.UpdateRecurringExpense)   // PUT for edit
 	http.HandleFunc("/recurring-expense/delete", handler.DeleteRecurringExpense) // DELETE
 
+	// Budgets
+	http.HandleFunc("/budget", handler.AddBudget)                // PUT for add
+	http.HandleFunc("/budgets", handler.GetBudgets)              // GET all
+	http.HandleFunc("/budget/edit", handler.UpdateBudget)        // PUT for edit
+	http.HandleFunc("/budget/delete", handler.DeleteBudget)      // DELETE
+	http.HandleFunc("/budgets/status", handler.GetBudgetStatus)  // GET for a month
+	http.HandleFunc("/budget/history", handler.GetBudgetHistory) // GET per-month balances
+
+	// Reports
+	http.HandleFunc("/reports/summary", handler.GetSummary)
+	http.HandleFunc("/balances", handler.GetBalances) // GET who owes whom
+
 	// Import/Export
 	http.HandleFunc("/export/csv", handler.ExportCSV)
+	http.HandleFunc("/export/qif", handler.ExportQIF)
+	http.HandleFunc("/export/backup", handler.ExportBackup)
+	http.HandleFunc("/import-profile", handler.AddImportProfile)             // PUT for add
+	http.HandleFunc("/import-profiles", handler.GetImportProfiles)           // GET all
+	http.HandleFunc("/import-profile/edit", handler.UpdateImportProfile)     // PUT for edit
+	http.HandleFunc("/import-profile/delete", handler.DeleteImportProfile)   // DELETE
+	http.HandleFunc("/category-rule", handler.AddCategoryRule)               // PUT for add
+	http.HandleFunc("/category-rules", handler.GetCategoryRules)             // GET all, in the order they apply
+	http.HandleFunc("/category-rule/edit", handler.UpdateCategoryRule)       // PUT for edit
+	http.HandleFunc("/category-rule/delete", handler.DeleteCategoryRule)     // DELETE
+	http.HandleFunc("/category-rules/preview", handler.PreviewCategoryRules) // GET changes per rule
+	http.HandleFunc("/category-rules/apply", handler.ApplyCategoryRules)     // POST to re-apply to all expenses
 	http.HandleFunc("/import/csv", handler.ImportCSV)
 	http.HandleFunc("/import/csvold", handler.ImportOldCSV)
+	http.HandleFunc("/import/ofx", handler.ImportOFX)
+	http.HandleFunc("/import/qif", handler.ImportQIF)
+	http.HandleFunc("/import/backup", handler.ImportBackup) // POST, mode=merge|replace
+	http.HandleFunc("/import/conversions", handler.ImportConversions)
+	http.HandleFunc("/import/rates", handler.ImportExchangeRates)
 
 	log.Println("Starting server on port 8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	if err := http.ListenAndServe(":8080", handler.Authenticate(http.DefaultServeMux)); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
 	runServer()
 }
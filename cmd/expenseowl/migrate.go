@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// copies everything from the storage configured by the usual STORAGE_* environment variables into
+// the one given by the flags, e.g.
+//
+//	STORAGE_URL=data expenseowl migrate -to-type postgres -to-url localhost:5432/expenseowl -to-user owl
+//
+// the target password is read from TARGET_STORAGE_PASS so it stays out of the process list, and
+// -force clears a non-empty target so a failed migration can be retried
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	toType := flags.String("to-type", "", "target backend: json, sqlite or postgres")
+	toURL := flags.String("to-url", "", "target directory for json and sqlite, or host:port/database for postgres")
+	toUser := flags.String("to-user", "", "target postgres user")
+	toSSL := flags.String("to-ssl", "disable", "target postgres SSL mode")
+	force := flags.Bool("force", false, "clear a non-empty target before copying")
+	flags.Parse(args)
+	if *toType == "" || *toURL == "" {
+		fmt.Fprintln(os.Stderr, "usage: expenseowl migrate -to-type <json|sqlite|postgres> -to-url <url> [-to-user <user>] [-to-ssl <mode>] [-force]")
+		os.Exit(2)
+	}
+	target := storage.SystemConfig{
+		StorageType: storage.BackendType(*toType),
+		StorageURL:  *toURL,
+		StorageUser: *toUser,
+		StoragePass: os.Getenv("TARGET_STORAGE_PASS"),
+		StorageSSL:  *toSSL,
+	}
+	source := storage.SystemConfig{}
+	source.SetStorageConfig()
+	if source.StorageType == target.StorageType && source.StorageURL == target.StorageURL {
+		return fmt.Errorf("source and target are the same %s storage at %s", source.StorageType, source.StorageURL)
+	}
+
+	from, err := storage.OpenStorage(source)
+	if err != nil {
+		return fmt.Errorf("failed to open source storage: %v", err)
+	}
+	defer from.Close()
+	to, err := storage.OpenStorage(target)
+	if err != nil {
+		return fmt.Errorf("failed to open target storage: %v", err)
+	}
+	defer to.Close()
+
+	log.Printf("Migrating %s storage at %s to %s storage at %s\n", source.StorageType, source.StorageURL, target.StorageType, target.StorageURL)
+	summary, err := storage.Migrate(from, to, *force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Verified %d users and %d API tokens (checksum %.12s)\n", summary.Users, summary.APITokens, summary.UsersChecksum)
+	for _, l := range summary.Ledgers {
+		fmt.Printf("Verified ledger %s: %d expenses, %d recurring expenses, %d budgets, %d import profiles, %d category rules, %d tags, %d exchange rates (checksum %.12s)\n",
+			l.Name, l.Expenses, l.RecurringExpenses, l.Budgets, l.ImportProfiles, l.CategoryRules, l.Tags, l.ExchangeRates, l.Checksum)
+	}
+	log.Println("Migration complete")
+	return nil
+}
@@ -0,0 +1,597 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+	"github.com/tanq16/expenseowl/internal/web"
+)
+
+const (
+	sessionCookieName = "expenseowl_session"
+	csrfCookieName    = "expenseowl_csrf" // readable by page scripts, which echo it in csrfHeaderName
+	csrfHeaderName    = "X-CSRF-Token"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// paths reachable without signing in
+var publicPaths = map[string]bool{
+	"/login":         true,
+	"/setup":         true,
+	"/auth/status":   true,
+	"/version":       true,
+	"/functions.js":  true,
+	"/style.css":     true,
+	"/fa.min.css":    true,
+	"/favicon.ico":   true,
+	"/manifest.json": true,
+	"/sw.js":         true,
+}
+
+var publicPrefixes = []string{"/pwa/", "/webfonts/"}
+
+// paths that cannot be used with an API token, so a leaked token cannot mint more tokens, change
+// passwords or manage accounts, which would let it create an admin to sign in as
+var sessionOnlyPaths = map[string]bool{
+	"/tokens":        true,
+	"/token":         true,
+	"/token/delete":  true,
+	"/users":         true,
+	"/user":          true,
+	"/user/delete":   true,
+	"/user/password": true,
+	"/logout":        true,
+}
+
+// how often a token's last-used time is written back to storage
+const tokenTouchInterval = time.Minute
+
+// HTML pages, which redirect to the login page instead of returning 401
+var pagePaths = map[string]bool{"/": true, "/table": true, "/settings": true}
+
+// serializes first-run setup so only one admin account can be bootstrapped
+var setupMu sync.Mutex
+
+// compared against when a username does not exist, so failed logins take the same time either way
+var dummyPasswordHash, _ = func() (string, error) {
+	var u storage.User
+	err := u.SetPassword("expenseowl-dummy-password")
+	return u.PasswordHash, err
+}()
+
+// user as returned by the API, without the password hash
+type userView struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Admin     bool      `json:"admin"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Admin    bool   `json:"admin"`
+}
+
+func newUserView(u storage.User) userView {
+	return userView{ID: u.ID, Username: u.Username, Admin: u.Admin, CreatedAt: u.CreatedAt}
+}
+
+// Authenticate wraps the router, requiring a valid session or API token for everything except public paths;
+// session requests also need a matching CSRF token for every request that is not a safe method
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token, ok := bearerToken(r); ok {
+			h.authenticateToken(w, r, next, token)
+			return
+		}
+		user, session, err := h.sessionFromRequest(r)
+		if err != nil {
+			if pagePaths[r.URL.Path] && r.Method == http.MethodGet {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Authentication required"})
+			return
+		}
+		if !isSafeMethod(r.Method) && subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeaderName)), []byte(session.CSRFToken)) != 1 {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Invalid CSRF token"})
+			return
+		}
+		h.serveAs(w, r, next, user)
+	})
+}
+
+// serves a request authenticated by an API token, enforcing the token's scope
+func (h *Handler) authenticateToken(w http.ResponseWriter, r *http.Request, next http.Handler, plain string) {
+	token, err := h.storage.GetAPITokenByHash(storage.HashToken(plain))
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Invalid API token"})
+		return
+	}
+	user, err := h.storage.GetUser(token.UserID)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Invalid API token"})
+		return
+	}
+	if sessionOnlyPaths[r.URL.Path] {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "This endpoint requires a signed-in session"})
+		return
+	}
+	if !isSafeMethod(r.Method) && token.Scope != storage.ScopeReadWrite {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "API token is read-only"})
+		return
+	}
+	if now := time.Now(); now.Sub(token.LastUsedAt) > tokenTouchInterval {
+		if err := h.storage.TouchAPIToken(token.ID, now); err != nil {
+			log.Printf("API ERROR: Failed to update token usage: %v\n", err)
+		}
+	}
+	h.serveAs(w, r, next, user)
+}
+
+// returns the token from an 'Authorization: Bearer' header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func isPublicPath(path string) bool {
+	if publicPaths[path] {
+		return true
+	}
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// looks up the session and user named by the session cookie
+func (h *Handler) sessionFromRequest(r *http.Request) (storage.User, storage.Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return storage.User{}, storage.Session{}, err
+	}
+	session, err := h.storage.GetSession(storage.HashToken(cookie.Value))
+	if err != nil {
+		return storage.User{}, storage.Session{}, err
+	}
+	user, err := h.storage.GetUser(session.UserID)
+	if err != nil {
+		return storage.User{}, storage.Session{}, err
+	}
+	return user, session, nil
+}
+
+// returns the signed-in user set by Authenticate
+func currentUser(r *http.Request) (storage.User, bool) {
+	user, ok := r.Context().Value(userContextKey).(storage.User)
+	return user, ok
+}
+
+// writes a 403 and returns false unless the signed-in user is an admin
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := currentUser(r)
+	if !ok || !user.Admin {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Admin access required"})
+		return false
+	}
+	return true
+}
+
+// creates a session for the user and sets the session and CSRF cookies
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, user storage.User) error {
+	session, token, err := storage.NewSession(user.ID)
+	if err != nil {
+		return err
+	}
+	if err := h.storage.AddSession(session); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    session.CSRFToken,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{sessionCookieName, csrfCookieName} {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", MaxAge: -1})
+	}
+}
+
+// ------------------------------------------------------------
+// Login and Setup Handlers
+// ------------------------------------------------------------
+
+func (h *Handler) ServeLoginPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		h.Login(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := web.ServeTemplate(w, "login.html"); err != nil {
+		http.Error(w, "Failed to serve template", http.StatusInternalServerError)
+	}
+}
+
+// reports whether first-run setup is pending and who is signed in
+func (h *Handler) GetAuthStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	users, err := h.storage.GetUsers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get users"})
+		log.Printf("API ERROR: Failed to get users: %v\n", err)
+		return
+	}
+	status := map[string]any{"setupRequired": len(users) == 0}
+	if user, _, err := h.sessionFromRequest(r); err == nil {
+		status["user"] = newUserView(user)
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var creds credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	user, err := h.storage.GetUserByName(strings.ToLower(strings.TrimSpace(creds.Username)))
+	if err != nil {
+		user = storage.User{PasswordHash: dummyPasswordHash}
+	}
+	if !user.CheckPassword(creds.Password) || err != nil {
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Invalid username or password"})
+		log.Printf("API ERROR: Failed login for user %q\n", creds.Username)
+		return
+	}
+	if err := h.startSession(w, r, user); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to start session"})
+		log.Printf("API ERROR: Failed to start session: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUserView(user))
+}
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if err := h.storage.RemoveSession(storage.HashToken(cookie.Value)); err != nil {
+			log.Printf("API ERROR: Failed to remove session: %v\n", err)
+		}
+	}
+	clearSessionCookies(w)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// creates the first admin account; only allowed while no users exist
+func (h *Handler) Setup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var creds credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	user := storage.User{Admin: true}
+	if err := user.SetCredentials(creds.Username, creds.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	setupMu.Lock()
+	defer setupMu.Unlock()
+	users, err := h.storage.GetUsers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get users"})
+		log.Printf("API ERROR: Failed to get users: %v\n", err)
+		return
+	}
+	if len(users) > 0 {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Setup has already been completed"})
+		return
+	}
+	user, err = h.storage.AddUser(user)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create admin account"})
+		log.Printf("API ERROR: Failed to create admin account: %v\n", err)
+		return
+	}
+	log.Printf("Created admin account %s\n", user.Username)
+	if err := h.startSession(w, r, user); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to start session"})
+		log.Printf("API ERROR: Failed to start session: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newUserView(user))
+}
+
+// ------------------------------------------------------------
+// User Handlers
+// ------------------------------------------------------------
+
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	users, err := h.storage.GetUsers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get users"})
+		log.Printf("API ERROR: Failed to get users: %v\n", err)
+		return
+	}
+	views := make([]userView, 0, len(users))
+	for _, u := range users {
+		views = append(views, newUserView(u))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (h *Handler) AddUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	var creds credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	user := storage.User{Admin: creds.Admin}
+	if err := user.SetCredentials(creds.Username, creds.Password); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	user, err := h.storage.AddUser(user)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to add user: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, newUserView(user))
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if !requireAdmin(w, r) {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if user, _ := currentUser(r); user.ID == id {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "You cannot delete your own account"})
+		return
+	}
+	if err := h.storage.RemoveUser(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete user"})
+		log.Printf("API ERROR: Failed to delete user: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// changes the signed-in user's password after checking the current one, signing out the user's
+// other sessions and, when asked, revoking the user's API tokens
+func (h *Handler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+		RevokeTokens    bool   `json:"revokeTokens"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	user, ok := currentUser(r)
+	if !ok || !user.CheckPassword(req.CurrentPassword) {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Current password is incorrect"})
+		return
+	}
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.storage.UpdateUser(user.ID, user); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update password"})
+		log.Printf("API ERROR: Failed to update password: %v\n", err)
+		return
+	}
+	var keep string
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		keep = storage.HashToken(cookie.Value)
+	}
+	if err := h.storage.RemoveUserSessions(user.ID, keep); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to sign out other sessions"})
+		log.Printf("API ERROR: Failed to remove sessions after password change: %v\n", err)
+		return
+	}
+	if req.RevokeTokens {
+		tokens, err := h.storage.GetAPITokens(user.ID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke API tokens"})
+			log.Printf("API ERROR: Failed to retrieve API tokens: %v\n", err)
+			return
+		}
+		for _, t := range tokens {
+			if err := h.storage.RemoveAPIToken(t.ID); err != nil {
+				writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke API tokens"})
+				log.Printf("API ERROR: Failed to delete API token: %v\n", err)
+				return
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// ------------------------------------------------------------
+// API Token Handlers
+// ------------------------------------------------------------
+
+// token as returned by the API, without its hash
+type apiTokenView struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Scope      string    `json:"scope"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	Token      string    `json:"token,omitempty"` // only set in the response that creates it
+}
+
+func newAPITokenView(t storage.APIToken) apiTokenView {
+	return apiTokenView{ID: t.ID, Name: t.Name, Scope: t.Scope, CreatedAt: t.CreatedAt, LastUsedAt: t.LastUsedAt}
+}
+
+// lists the signed-in user's tokens
+func (h *Handler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	user, _ := currentUser(r)
+	tokens, err := h.storage.GetAPITokens(user.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get API tokens"})
+		log.Printf("API ERROR: Failed to get API tokens: %v\n", err)
+		return
+	}
+	views := make([]apiTokenView, 0, len(tokens))
+	for _, t := range tokens {
+		views = append(views, newAPITokenView(t))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// creates a token for the signed-in user; the plain token is only ever returned here
+func (h *Handler) AddAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	user, _ := currentUser(r)
+	token, plain, err := storage.NewAPIToken(user.ID, req.Name, req.Scope)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	token, err = h.storage.AddAPIToken(token)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create API token"})
+		log.Printf("API ERROR: Failed to create API token: %v\n", err)
+		return
+	}
+	view := newAPITokenView(token)
+	view.Token = plain
+	writeJSON(w, http.StatusCreated, view)
+}
+
+// revokes one of the signed-in user's tokens; admins can revoke any token
+func (h *Handler) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	user, _ := currentUser(r)
+	owner := user.ID
+	if user.Admin {
+		owner = ""
+	}
+	tokens, err := h.storage.GetAPITokens(owner)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get API tokens"})
+		log.Printf("API ERROR: Failed to get API tokens: %v\n", err)
+		return
+	}
+	if !slices.ContainsFunc(tokens, func(t storage.APIToken) bool { return t.ID == id }) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "API token not found"})
+		return
+	}
+	if err := h.storage.RemoveAPIToken(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke API token"})
+		log.Printf("API ERROR: Failed to revoke API token: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// how a restored backup is combined with the ledger's data
+const (
+	restoreMerge   = "merge"   // add records the ledger doesn't have, keeping its own on conflict
+	restoreReplace = "replace" // discard the ledger's data in favour of the backup's
+)
+
+// exports the ledger's config, recurring rules, expenses and exchange rates as a versioned JSON archive
+func (h *Handler) ExportBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	backup, err := storage.CreateBackup(h.ledger(r))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create backup"})
+		log.Printf("API ERROR: Failed to create backup: %v\n", err)
+		return
+	}
+	filename := fmt.Sprintf("expenseowl-backup-%s.json", backup.CreatedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	writeJSON(w, http.StatusOK, backup)
+	log.Printf("HTTP: Exported backup with %d expenses\n", len(backup.Expenses))
+}
+
+// restores a backup into the ledger, merging it with the ledger's data unless the 'mode' form
+// value is 'replace'
+func (h *Handler) ImportBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(64 << 20); err != nil { // 64MB max, backups hold every expense
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = restoreMerge
+	}
+	if mode != restoreMerge && mode != restoreReplace {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid restore mode: '%s'. Must be 'merge' or 'replace'", mode)})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	var backup storage.Backup
+	if err := json.NewDecoder(file).Decode(&backup); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to parse backup file"})
+		return
+	}
+	if err := backup.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	data := backup.LedgerData
+	if mode == restoreMerge {
+		current, err := storage.CreateBackup(h.ledger(r))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to read current data"})
+			log.Printf("API ERROR: Failed to read current data for restore: %v\n", err)
+			return
+		}
+		data = storage.MergeLedgerData(current.LedgerData, backup.LedgerData)
+	}
+	if err := h.ledger(r).ReplaceLedgerData(data); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to restore backup"})
+		log.Printf("API ERROR: Failed to restore backup: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":             "success",
+		"mode":               mode,
+		"backup_created_at":  backup.CreatedAt.Format(time.RFC3339),
+		"expenses":           len(data.Expenses),
+		"recurring_expenses": len(data.Config.RecurringExpenses),
+		"exchange_rates":     len(data.ExchangeRates),
+	})
+	log.Printf("HTTP: Restored backup (%s), ledger now has %d expenses\n", mode, len(data.Expenses))
+}
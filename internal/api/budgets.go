@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func (h *Handler) GetBudgets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	budgets, err := h.ledger(r).GetBudgets()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get budgets"})
+		log.Printf("API ERROR: Failed to get budgets: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, budgets)
+}
+
+func (h *Handler) AddBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var budget storage.Budget
+	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := budget.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	store := h.ledger(r)
+	if !checkLedgerBudget(w, store, "", budget) {
+		return
+	}
+	budget, err := store.AddBudget(budget)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to add budget"})
+		log.Printf("API ERROR: Failed to add budget: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, budget)
+}
+
+func (h *Handler) UpdateBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	var budget storage.Budget
+	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := budget.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	store := h.ledger(r)
+	if !checkLedgerBudget(w, store, id, budget) {
+		return
+	}
+	if err := store.UpdateBudget(id, budget); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update budget"})
+		log.Printf("API ERROR: Failed to update budget: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// checks a validated budget against the ledger, which must have its category, have the budget being
+// updated (id, empty for a new budget) and no other budget for the same category or tag; writes the
+// error response and returns false otherwise
+func checkLedgerBudget(w http.ResponseWriter, store storage.Storage, id string, budget storage.Budget) bool {
+	config, err := store.GetConfig()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get budgets"})
+		log.Printf("API ERROR: Failed to get config: %v\n", err)
+		return false
+	}
+	if budget.Category != "" && !slices.ContainsFunc(config.Categories, func(c string) bool { return strings.EqualFold(c, budget.Category) }) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("category %s does not exist", budget.Category)})
+		return false
+	}
+	if id != "" && !slices.ContainsFunc(config.Budgets, func(b storage.Budget) bool { return b.ID == id }) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Budget not found"})
+		return false
+	}
+	budget.ID = id
+	if storage.BudgetConflicts(config.Budgets, budget) {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("a budget for '%s' already exists", budget.Target())})
+		return false
+	}
+	return true
+}
+
+func (h *Handler) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if err := h.ledger(r).RemoveBudget(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete budget"})
+		log.Printf("API ERROR: Failed to delete budget: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// returns spent/remaining for every budget in the start-date aligned month containing 'date' (default today),
+// including balances carried over from earlier months for rollover budgets
+func (h *Handler) GetBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	loc, err := parseLocation(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	ref, err := parseReference(r, loc)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	statuses, err := storage.GetBudgetStatuses(h.ledger(r), ref)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute budget status"})
+		log.Printf("API ERROR: Failed to compute budget status: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// returns the per-month statuses of one budget from its start date through the month containing 'date'
+func (h *Handler) GetBudgetHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	loc, err := parseLocation(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	ref, err := parseReference(r, loc)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	config, err := h.ledger(r).GetConfig()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get config"})
+		log.Printf("API ERROR: Failed to get config: %v\n", err)
+		return
+	}
+	idx := slices.IndexFunc(config.Budgets, func(b storage.Budget) bool { return b.ID == id })
+	if idx < 0 {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Budget not found"})
+		return
+	}
+	history, err := storage.GetBudgetHistory(h.ledger(r), config.Budgets[idx], ref, config.StartDate)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute budget history"})
+		log.Printf("API ERROR: Failed to compute budget history: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
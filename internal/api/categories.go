@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// renames a category on every expense, recurring expense, budget and category rule using it
+func (h *Handler) RenameCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	to, err := storage.ValidateCategory(req.To)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	store := h.ledger(r)
+	categories, err := store.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename category"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return
+	}
+	exists, err := categoryExists(store, categories, req.From)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename category"})
+		log.Printf("API ERROR: Failed to get category usage: %v\n", err)
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("category %s not found", req.From)})
+		return
+	}
+	// changing only the case of a category is a rename, anything else that exists has to be merged
+	if !strings.EqualFold(req.From, to) {
+		exists, err := categoryExists(store, categories, to)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename category"})
+			log.Printf("API ERROR: Failed to get category usage: %v\n", err)
+			return
+		}
+		if exists {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("category %s already exists, merge the categories instead", to)})
+			return
+		}
+	}
+	if err := store.RenameCategory(req.From, to); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename category"})
+		log.Printf("API ERROR: Failed to rename category: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	log.Printf("HTTP: Renamed category %s to %s\n", req.From, to)
+}
+
+// merges a category into another, moving its expenses, recurring expenses and rules over and
+// dropping it from the category list
+func (h *Handler) MergeCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req struct {
+		From string `json:"from"`
+		Into string `json:"into"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	h.reassignCategory(w, h.ledger(r), req.From, req.Into)
+}
+
+// deletes a category; expenses, recurring expenses and rules using it move to the 'reassign'
+// parameter, which is only optional for a category nothing uses
+func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "name parameter is required"})
+		return
+	}
+	store := h.ledger(r)
+	if reassign := r.URL.Query().Get("reassign"); reassign != "" {
+		h.reassignCategory(w, store, name, reassign)
+		return
+	}
+	usage, err := categoryUsage(store, name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete category"})
+		log.Printf("API ERROR: Failed to get category usage: %v\n", err)
+		return
+	}
+	if usage != "" {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("category %s is used by %s, choose a category to reassign them to", name, usage)})
+		return
+	}
+	categories, err := store.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete category"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return
+	}
+	remaining := slices.DeleteFunc(slices.Clone(categories), func(c string) bool { return strings.EqualFold(c, name) })
+	if len(remaining) == len(categories) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("category %s not found", name)})
+		return
+	}
+	if len(remaining) == 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least one category is required"})
+		return
+	}
+	if err := store.UpdateCategories(remaining); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete category"})
+		log.Printf("API ERROR: Failed to update categories: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// moves everything in the from category to the existing into category, which replaces it
+func (h *Handler) reassignCategory(w http.ResponseWriter, store storage.Storage, from, into string) {
+	if strings.EqualFold(from, into) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "cannot merge a category into itself"})
+		return
+	}
+	config, err := store.GetConfig()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge categories"})
+		log.Printf("API ERROR: Failed to get config: %v\n", err)
+		return
+	}
+	fromExists, err := categoryExists(store, config.Categories, from)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge categories"})
+		log.Printf("API ERROR: Failed to get category usage: %v\n", err)
+		return
+	}
+	intoExists, err := categoryExists(store, config.Categories, into)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge categories"})
+		log.Printf("API ERROR: Failed to get category usage: %v\n", err)
+		return
+	}
+	if !fromExists || !intoExists {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Both categories must exist"})
+		return
+	}
+	// a category can only have one budget, so one of the two has to go first
+	hasBudget := func(name string) bool {
+		return slices.ContainsFunc(config.Budgets, func(b storage.Budget) bool { return strings.EqualFold(b.Category, name) })
+	}
+	if hasBudget(from) && hasBudget(into) {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Both categories have a budget, delete one of them first"})
+		return
+	}
+	if i := slices.IndexFunc(config.Categories, func(c string) bool { return strings.EqualFold(c, into) }); i >= 0 {
+		into = config.Categories[i]
+	}
+	if err := store.RenameCategory(from, into); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge categories"})
+		log.Printf("API ERROR: Failed to merge categories: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	log.Printf("HTTP: Merged category %s into %s\n", from, into)
+}
+
+func hasCategory(categories []string, name string) bool {
+	return slices.ContainsFunc(categories, func(c string) bool { return strings.EqualFold(c, name) })
+}
+
+// reports whether the ledger lists the category or anything still uses it, as expenses keep
+// categories that were dropped from the list
+func categoryExists(store storage.Storage, categories []string, name string) (bool, error) {
+	if hasCategory(categories, name) {
+		return true, nil
+	}
+	usage, err := categoryUsage(store, name)
+	return usage != "", err
+}
+
+// describes what still uses the category, or returns an empty string when nothing does
+func categoryUsage(store storage.Storage, name string) (string, error) {
+	config, err := store.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve expenses: %v", err)
+	}
+	var counts []string
+	count := func(n int, what string) {
+		if n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, what))
+		}
+	}
+	count(countFunc(expenses, func(e storage.Expense) bool { return strings.EqualFold(e.Category, name) }), "expenses")
+	count(countFunc(config.RecurringExpenses, func(re storage.RecurringExpense) bool { return strings.EqualFold(re.Category, name) }), "recurring expenses")
+	count(countFunc(config.Budgets, func(b storage.Budget) bool { return strings.EqualFold(b.Category, name) }), "budgets")
+	count(countFunc(config.CategoryRules, func(cr storage.CategoryRule) bool { return strings.EqualFold(cr.Category, name) }), "category rules")
+	return strings.Join(counts, ", "), nil
+}
+
+func countFunc[T any](items []T, match func(T) bool) int {
+	n := 0
+	for _, item := range items {
+		if match(item) {
+			n++
+		}
+	}
+	return n
+}
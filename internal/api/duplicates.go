@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// response to adding an expense that looks like one the ledger already has
+type duplicateResponse struct {
+	Error      string                  `json:"error"`
+	Duplicates []storage.DuplicatePair `json:"duplicates"`
+}
+
+// lists pairs of expenses in the ledger that look like the same transaction recorded twice
+func (h *Handler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	expenses, err := h.ledger(r).GetAllExpenses()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, storage.FindDuplicates(expenses))
+}
+
+// merges two expenses into the one to keep, which gains the tags of the other, and deletes the other
+func (h *Handler) MergeExpenses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload struct {
+		Keep   string `json:"keep"`
+		Remove string `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if payload.Keep == "" || payload.Remove == "" || payload.Keep == payload.Remove {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "'keep' and 'remove' must be two different expense IDs"})
+		return
+	}
+	store := h.ledger(r)
+	keep, err := store.GetExpense(payload.Keep)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense to keep not found"})
+		return
+	}
+	remove, err := store.GetExpense(payload.Remove)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense to remove not found"})
+		return
+	}
+	merged := storage.MergeExpenses(keep, remove)
+	if err := store.MergeExpenses(merged, remove.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge expenses"})
+		log.Printf("API ERROR: Failed to merge expenses: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, merged)
+	log.Printf("HTTP: Merged expense %s into %s\n", remove.ID, merged.ID)
+}
+
+// expenses of the ledger the new expense likely duplicates
+func likelyDuplicates(store storage.Storage, expense storage.Expense) ([]storage.DuplicatePair, error) {
+	if expense.Currency == "" {
+		currency, err := store.GetCurrency()
+		if err != nil {
+			return nil, err
+		}
+		expense.Currency = currency
+	}
+	query := storage.DuplicateCandidates(expense)
+	var candidates []storage.Expense
+	for {
+		page, err := store.QueryExpenses(query)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, page.Expenses...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	return storage.NewDuplicateIndex(candidates).Find(expense, nil), nil
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tanq16/expenseowl/internal/storage"
@@ -47,7 +48,7 @@ func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	config, err := h.storage.GetConfig()
+	config, err := h.ledger(r).GetConfig()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get config"})
 		log.Printf("API ERROR: Failed to get config: %v\n", err)
@@ -61,7 +62,7 @@ func (h *Handler) GetCategories(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	categories, err := h.storage.GetCategories()
+	categories, err := h.ledger(r).GetCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
 		log.Printf("API ERROR: Failed to get categories: %v\n", err)
@@ -90,7 +91,30 @@ func (h *Handler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
 		}
 		sanitizedCategories = append(sanitizedCategories, sanitized)
 	}
-	if err := h.storage.UpdateCategories(sanitizedCategories); err != nil {
+	store := h.ledger(r)
+	current, err := store.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return
+	}
+	// dropping a category would leave its expenses behind, they have to be reassigned by deleting it
+	for _, category := range current {
+		if hasCategory(sanitizedCategories, category) {
+			continue
+		}
+		usage, err := categoryUsage(store, category)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
+			log.Printf("API ERROR: Failed to get category usage: %v\n", err)
+			return
+		}
+		if usage != "" {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("category %s is used by %s, delete it to reassign them", category, usage)})
+			return
+		}
+	}
+	if err := store.UpdateCategories(sanitizedCategories); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
 		log.Printf("API ERROR: Failed to update categories: %v\n", err)
 		return
@@ -103,7 +127,7 @@ func (h *Handler) GetCurrency(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	currency, err := h.storage.GetCurrency()
+	currency, err := h.ledger(r).GetCurrency()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currency"})
 		log.Printf("API ERROR: Failed to get currency: %v\n", err)
@@ -122,7 +146,7 @@ func (h *Handler) UpdateCurrency(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
-	if err := h.storage.UpdateCurrency(currency); err != nil {
+	if err := h.ledger(r).UpdateCurrency(currency); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		log.Printf("API ERROR: Failed to update currency: %v\n", err)
 		return
@@ -135,7 +159,7 @@ func (h *Handler) GetStartDate(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	startDate, err := h.storage.GetStartDate()
+	startDate, err := h.ledger(r).GetStartDate()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get start date"})
 		log.Printf("API ERROR: Failed to get start date: %v\n", err)
@@ -154,7 +178,7 @@ func (h *Handler) UpdateStartDate(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
-	if err := h.storage.UpdateStartDate(startDate); err != nil {
+	if err := h.ledger(r).UpdateStartDate(startDate); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		log.Printf("API ERROR: Failed to update start date: %v\n", err)
 		return
@@ -162,10 +186,131 @@ func (h *Handler) UpdateStartDate(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+func (h *Handler) GetConversions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	conversions, err := h.ledger(r).GetConversions()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get conversions"})
+		log.Printf("API ERROR: Failed to get conversions: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, conversions)
+}
+
+func (h *Handler) UpdateConversions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var conversions map[string]float64
+	if err := json.NewDecoder(r.Body).Decode(&conversions); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if _, err := storage.ValidateConversions(conversions); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.ledger(r).UpdateConversions(conversions); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update conversions"})
+		log.Printf("API ERROR: Failed to update conversions: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	rates, err := h.ledger(r).GetExchangeRates(strings.ToLower(r.URL.Query().Get("currency")))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get exchange rates"})
+		log.Printf("API ERROR: Failed to get exchange rates: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+// adds or replaces dated exchange rates
+func (h *Handler) AddExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var rates []storage.ExchangeRate
+	if err := json.NewDecoder(r.Body).Decode(&rates); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if err := h.ledger(r).AddExchangeRates(rates); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save exchange rates"})
+		log.Printf("API ERROR: Failed to save exchange rates: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handler) DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	currency := strings.ToLower(r.URL.Query().Get("currency"))
+	date, err := parseDate(r.URL.Query().Get("date"))
+	if currency == "" || err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Currency and date parameters are required"})
+		return
+	}
+	if err := h.ledger(r).RemoveExchangeRate(currency, date); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete exchange rate"})
+		log.Printf("API ERROR: Failed to delete exchange rate: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
 // ------------------------------------------------------------
 // Expense Handlers
 // ------------------------------------------------------------
 
+// expense as returned to clients, with its amount converted to the base currency
+type expenseView struct {
+	storage.Expense
+	BaseAmount   float64 `json:"baseAmount"`
+	BaseCurrency string  `json:"baseCurrency"`
+	Converted    bool    `json:"converted"` // false when no rate is known for the currency
+}
+
+type expensePageView struct {
+	Expenses   []expenseView `json:"expenses"`
+	Total      int           `json:"total"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+func (h *Handler) expenseViews(r *http.Request, expenses []storage.Expense) ([]expenseView, error) {
+	converter, err := storage.LoadConverter(h.ledger(r))
+	if err != nil {
+		return nil, err
+	}
+	views := make([]expenseView, 0, len(expenses))
+	for _, e := range expenses {
+		amount, ok := converter.Convert(e.Amount, e.Currency, e.Date)
+		views = append(views, expenseView{Expense: e, BaseAmount: amount, BaseCurrency: converter.Base, Converted: ok})
+	}
+	return views, nil
+}
+
 func (h *Handler) AddExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -176,6 +321,16 @@ func (h *Handler) AddExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
+	// rules categorize expenses added without a category, or any expense when asked to
+	applyRules, _ := strconv.ParseBool(r.URL.Query().Get("applyRules"))
+	applyRules = applyRules || expense.Category == ""
+	if applyRules {
+		if err := applyCategoryRules(h.ledger(r), &expense); err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply category rules"})
+			log.Printf("API ERROR: Failed to apply category rules: %v\n", err)
+			return
+		}
+	}
 	if err := expense.Validate(); err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
@@ -183,11 +338,32 @@ func (h *Handler) AddExpense(w http.ResponseWriter, r *http.Request) {
 	if expense.Date.IsZero() {
 		expense.Date = time.Now()
 	}
-	if err := h.storage.AddExpense(expense); err != nil {
+	// clients that ask are refused an expense that looks like one the ledger already has
+	if check, _ := strconv.ParseBool(r.URL.Query().Get("checkDuplicates")); check {
+		duplicates, err := likelyDuplicates(h.ledger(r), expense)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to check for duplicates"})
+			log.Printf("API ERROR: Failed to check for duplicate expenses: %v\n", err)
+			return
+		}
+		if len(duplicates) > 0 {
+			writeJSON(w, http.StatusConflict, duplicateResponse{
+				Error:      "Expense looks like one that already exists, add it without checkDuplicates to keep both",
+				Duplicates: duplicates,
+			})
+			return
+		}
+	}
+	if err := h.ledger(r).AddExpense(expense); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save expense"})
 		log.Printf("API ERROR: Failed to save expense: %v\n", err)
 		return
 	}
+	if applyRules {
+		if err := addMissingCategories(h.ledger(r), []storage.Expense{expense}); err != nil {
+			log.Printf("API ERROR: Failed to add category of new expense: %v\n", err)
+		}
+	}
 	writeJSON(w, http.StatusOK, expense)
 }
 
@@ -196,13 +372,93 @@ func (h *Handler) GetExpenses(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	expenses, err := h.storage.GetAllExpenses()
+	expenses, err := h.ledger(r).GetAllExpenses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
 		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, expenses)
+	views, err := h.expenseViews(r, expenses)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to convert expenses"})
+		log.Printf("API ERROR: Failed to convert expenses: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (h *Handler) QueryExpenses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	query, err := parseExpenseQuery(r)
+	if err == nil {
+		_, err = query.Normalize()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	page, err := h.ledger(r).QueryExpenses(query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to query expenses"})
+		log.Printf("API ERROR: Failed to query expenses: %v\n", err)
+		return
+	}
+	views, err := h.expenseViews(r, page.Expenses)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to convert expenses"})
+		log.Printf("API ERROR: Failed to convert expenses: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, expensePageView{Expenses: views, Total: page.Total, NextCursor: page.NextCursor})
+}
+
+// builds an expense query from URL parameters
+func parseExpenseQuery(r *http.Request) (storage.ExpenseQuery, error) {
+	params := r.URL.Query()
+	query := storage.ExpenseQuery{
+		Category: params.Get("category"),
+		Tag:      params.Get("tag"),
+		Name:     params.Get("name"),
+		Sort:     params.Get("sort"),
+		Cursor:   params.Get("cursor"),
+	}
+	if v := params.Get("from"); v != "" {
+		from, err := parseDate(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid 'from' date: %s", v)
+		}
+		query.From = from
+	}
+	if v := params.Get("to"); v != "" {
+		to, err := parseDate(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid 'to' date: %s", v)
+		}
+		if len(v) <= len("2006-01-02") {
+			to = to.AddDate(0, 0, 1).Add(-time.Nanosecond) // date-only upper bound covers the whole day
+		}
+		query.To = to
+	}
+	for key, target := range map[string]**float64{"minAmount": &query.MinAmount, "maxAmount": &query.MaxAmount} {
+		if v := params.Get(key); v != "" {
+			amount, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return query, fmt.Errorf("invalid '%s': %s", key, v)
+			}
+			*target = &amount
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return query, fmt.Errorf("invalid 'limit': %s", v)
+		}
+		query.Limit = limit
+	}
+	return query, nil
 }
 
 func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
@@ -224,7 +480,7 @@ func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := h.storage.UpdateExpense(id, expense); err != nil {
+	if err := h.ledger(r).UpdateExpense(id, expense); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to edit expense"})
 		log.Printf("API ERROR: Failed to edit expense: %v\n", err)
 		return
@@ -242,7 +498,7 @@ func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
 		return
 	}
-	if err := h.storage.RemoveExpense(id); err != nil {
+	if err := h.ledger(r).RemoveExpense(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete expense"})
 		log.Printf("API ERROR: Failed to delete expense: %v\n", err)
 		return
@@ -262,7 +518,7 @@ func (h *Handler) DeleteMultipleExpenses(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
-	if err := h.storage.RemoveMultipleExpenses(payload.IDs); err != nil {
+	if err := h.ledger(r).RemoveMultipleExpenses(payload.IDs); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete multiple expenses"})
 		log.Printf("API ERROR: Failed to delete multiple expenses: %v\n", err)
 		return
@@ -288,7 +544,7 @@ func (h *Handler) AddRecurringExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := h.storage.AddRecurringExpense(re); err != nil {
+	if err := h.ledger(r).AddRecurringExpense(re); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to add recurring expense"})
 		log.Printf("API ERROR: Failed to add recurring expense: %v\n", err)
 		return
@@ -301,7 +557,7 @@ func (h *Handler) GetRecurringExpenses(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	res, err := h.storage.GetRecurringExpenses()
+	res, err := h.ledger(r).GetRecurringExpenses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get recurring expenses"})
 		log.Printf("API ERROR: Failed to get recurring expenses: %v\n", err)
@@ -331,7 +587,7 @@ func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := h.storage.UpdateRecurringExpense(id, re, updateAll); err != nil {
+	if err := h.ledger(r).UpdateRecurringExpense(id, re, updateAll); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update recurring expense"})
 		log.Printf("API ERROR: Failed to update recurring expense: %v\n", err)
 		return
@@ -351,7 +607,7 @@ func (h *Handler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request)
 	}
 	removeAll, _ := strconv.ParseBool(r.URL.Query().Get("removeAll"))
 
-	if err := h.storage.RemoveRecurringExpense(id, removeAll); err != nil {
+	if err := h.ledger(r).RemoveRecurringExpense(id, removeAll); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete recurring expense"})
 		log.Printf("API ERROR: Failed to delete recurring expense: %v\n", err)
 		return
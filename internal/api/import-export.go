@@ -1,9 +1,15 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
 	"net/http"
 	"slices"
 	"strconv"
@@ -19,19 +25,25 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	expenses, err := h.storage.GetAllExpenses()
+	expenses, err := h.ledger(r).GetAllExpenses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
 		log.Printf("API ERROR: Failed to retrieve expenses for CSV export: %v\n", err)
 		return
 	}
+	converter, err := storage.LoadConverter(h.ledger(r))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to load exchange rates"})
+		log.Printf("API ERROR: Failed to load exchange rates for CSV export: %v\n", err)
+		return
+	}
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=expenses.csv")
 	writer := csv.NewWriter(w)
 	defer writer.Flush()
 
 	// Write header
-	headers := []string{"ID", "Name", "Category", "Amount", "Date", "Tags"}
+	headers := []string{"ID", "Name", "Category", "Amount", "Currency", "Base Amount", "Date", "Tags"}
 	if err := writer.Write(headers); err != nil {
 		log.Printf("API ERROR: Failed to write CSV header: %v\n", err)
 		return
@@ -39,12 +51,14 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 
 	// Write records
 	for _, expense := range expenses {
+		baseAmount, _ := converter.Convert(expense.Amount, expense.Currency, expense.Date)
 		record := []string{
 			expense.ID,
 			expense.Name,
 			expense.Category,
-			// expense.Currency,
 			strconv.FormatFloat(expense.Amount, 'f', 2, 64),
+			expense.Currency,
+			strconv.FormatFloat(baseAmount, 'f', 2, 64),
 			expense.Date.Format(time.RFC3339),
 			strings.Join(expense.Tags, ","),
 		}
@@ -56,6 +70,42 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 	log.Println("HTTP: Exported expenses to CSV")
 }
 
+// exports all expenses to QIF as a single bank account; tags are written as the transaction's
+// classes after the category, 'L<category>/<tag>:<tag>'
+func (h *Handler) ExportQIF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	expenses, err := h.ledger(r).GetAllExpenses()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses for QIF export: %v\n", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/qif")
+	w.Header().Set("Content-Disposition", "attachment; filename=expenses.qif")
+	var b strings.Builder
+	b.WriteString("!Type:Bank\n")
+	for _, expense := range expenses {
+		category := expense.Category
+		if len(expense.Tags) > 0 {
+			category += "/" + strings.Join(expense.Tags, ":")
+		}
+		fmt.Fprintf(&b, "D%s\nT%s\nP%s\nL%s\n^\n",
+			expense.Date.Format("01/02/2006"),
+			strconv.FormatFloat(expense.Amount, 'f', 2, 64),
+			expense.Name,
+			category,
+		)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		log.Printf("API ERROR: Failed to write QIF file: %v\n", err)
+		return
+	}
+	log.Println("HTTP: Exported expenses to QIF")
+}
+
 // imports expenses from CSV
 func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -66,6 +116,16 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
 		return
 	}
+	mode, err := importMode(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	profile, err := h.importProfile(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	file, _, err := r.FormFile("file")
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
@@ -73,145 +133,207 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	reader.Comma = profile.Comma()
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
 		return
 	}
-	if len(records) < 2 {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
+	cols, err := resolveImportColumns(header, profile)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	header := records[0]
-	colMap := make(map[string]int)
-	for i, col := range header {
-		colMap[strings.ToLower(strings.TrimSpace(col))] = i
+	batch, err := h.newImportBatch(r, mode)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not prepare import"})
+		log.Printf("API ERROR: Failed to prepare CSV import: %v\n", err)
+		return
 	}
-	// Check for mandatory columns
-	requiredCols := []string{"name", "category", "amount", "date"}
-	for _, col := range requiredCols {
-		if _, ok := colMap[col]; !ok {
-			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Missing required column: %s", col)})
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			batch.reject(row, nil, err)
+			continue
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
 			return
 		}
+		if len(record) < len(header) {
+			batch.reject(row, nil, fmt.Errorf("incorrect column count"))
+			continue
+		}
+		// Expenses that already exist by ID are skipped without doing a clash resolution
+		if cols.id >= 0 && batch.existingIDs[record[cols.id]] {
+			batch.skip(row, nil, fmt.Sprintf("expense with ID '%s' already exists", record[cols.id]))
+			continue
+		}
+		expense, err := parseImportRow(record, cols, &profile)
+		if err != nil {
+			batch.reject(row, nil, err)
+			continue
+		}
+		batch.add(row, expense)
 	}
-	// Get optional column indices
-	idIdx, idExists := colMap["id"]
-	tagsIdx, tagsExists := colMap["tags"]
-	currencyIdx, currencyExists := colMap["currency"]
+	h.commitImport(w, batch, "CSV file")
+}
 
-	currentCategories, err := h.storage.GetCategories()
-	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
+// QIF sections holding bank-style transactions; investment, category, class and account lists are skipped
+var qifTransactionTypes = map[string]bool{"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true}
+
+// imports expenses from QIF, reading the date, amount, payee, memo and category fields of each
+// transaction; the classes after a '/' in the category become tags. Dates are month first unless
+// the 'dayFirst' form value is set
+func (h *Handler) ImportQIF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	categorySet := make(map[string]bool)
-	for _, cat := range currentCategories {
-		categorySet[strings.ToLower(cat)] = true
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
 	}
-	var newCategories []string
-	var importedCount, skippedCount int
-	// TODO: might be worth setting default currency when we have currency updation behavior
-	currencyVal, err := h.storage.GetCurrency()
+	mode, err := importMode(r)
 	if err != nil {
-		log.Printf("Error: Could not retrieve currency, shutting down import: %v\n", err)
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve currency"})
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	dayFirst, _ := strconv.ParseBool(r.FormValue("dayFirst"))
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
 
-	for i, record := range records[1:] {
-		if len(record) != len(header) {
-			log.Printf("Warning: Skipping row %d due to incorrect column count\n", i+2)
-			skippedCount++
-			continue
-		}
-
-		// Check if expense exists by ID, if provided - without doing a clash resolution
-		if idExists {
-			id := record[idIdx]
-			if _, err := h.storage.GetExpense(id); err == nil {
-				log.Printf("Info: Skipping row %d because expense with ID '%s' already exists\n", i+2, id)
-				skippedCount++
-				continue
-			}
+	batch, err := h.newImportBatch(r, mode)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not prepare import"})
+		log.Printf("API ERROR: Failed to prepare QIF import: %v\n", err)
+		return
+	}
+	category := importCategory(r)
+	scanner := bufio.NewScanner(file)
+	inTransactions := true // files without a !Type header hold bank transactions
+	fields := map[byte]string{}
+	start := 0 // line of the transaction being read
+	line := 0
+	finish := func() {
+		if len(fields) == 0 {
+			return
 		}
-
-		// Check for currency field, if provided - default is retrieved
-		localCurrency := currencyVal
-		if currencyExists {
-			currency := record[currencyIdx]
-			if !slices.Contains(storage.SupportedCurrencies, currency) {
-				log.Printf("Warning: Skipping row %d due to invalid currency: %s\n", i+2, currency)
-				skippedCount++
-				continue
+		if inTransactions {
+			expense, err := parseQIFTransaction(fields, dayFirst, category)
+			if err != nil {
+				batch.reject(start, nil, err)
+			} else {
+				batch.add(start, expense)
 			}
-			localCurrency = strings.TrimSpace(currency)
 		}
-
-		amount, err := strconv.ParseFloat(record[colMap["amount"]], 64)
-		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid amount: %s\n", i+2, record[colMap["amount"]])
-			skippedCount++
-			continue
+		clear(fields)
+	}
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
 		}
-		date, err := parseDate(record[colMap["date"]])
-		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid date: %v\n", i+2, err)
-			skippedCount++
+		if strings.TrimSpace(text) == "" {
 			continue
 		}
-		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
-			newCategories = append(newCategories, category)
-			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
-		}
-		var tags []string
-		if tagsExists {
-			tagsStr := record[tagsIdx]
-			if tagsStr != "" {
-				tags = strings.Split(tagsStr, ",")
-				for i := range tags {
-					tags[i] = strings.TrimSpace(tags[i])
-				}
+		switch {
+		case text[0] == '^':
+			finish()
+		case text[0] == '!':
+			finish()
+			if header := strings.ToLower(strings.TrimSpace(text)); strings.HasPrefix(header, "!type:") {
+				inTransactions = qifTransactionTypes[strings.TrimSpace(strings.TrimPrefix(header, "!type:"))]
+			} else if strings.HasPrefix(header, "!option") || strings.HasPrefix(header, "!clear") {
+				continue
+			} else {
+				inTransactions = false // !Account and other lists
 			}
+		case text[0] == 'S' || text[0] == 'E' || text[0] == '$':
+			continue // split lines, the transaction's total and category are used
+		default:
+			if len(fields) == 0 {
+				start = line
+			}
+			fields[text[0]] = strings.TrimSpace(text[1:])
 		}
+	}
+	if err := scanner.Err(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read QIF file"})
+		return
+	}
+	finish()
+	if len(batch.rows) == 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "QIF file has no transactions"})
+		return
+	}
+	h.commitImport(w, batch, "QIF file")
+}
 
-		expense := storage.Expense{
-			Name:     strings.TrimSpace(record[colMap["name"]]),
-			Category: category,
-			Amount:   amount,
-			Currency: localCurrency,
-			Date:     date,
-			Tags:     tags,
-		}
-		if err := expense.Validate(); err != nil {
-			log.Printf("Warning: Skipping row %d due to validation error: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		if err := h.storage.AddExpense(expense); err != nil {
-			log.Printf("Error: Could not add expense from row %d: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		importedCount++
-		time.Sleep(10 * time.Millisecond) // Throttle to reduce storage overhead
+// builds an expense from the fields of a QIF transaction, keyed by their field letter
+func parseQIFTransaction(fields map[byte]string, dayFirst bool, defaultCategory string) (storage.Expense, error) {
+	amountStr := fields['T']
+	if amountStr == "" {
+		amountStr = fields['U']
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(amountStr, ",", ""), 64)
+	if err != nil {
+		return storage.Expense{}, fmt.Errorf("invalid amount: %s", amountStr)
+	}
+	date, err := parseQIFDate(fields['D'], dayFirst)
+	if err != nil {
+		return storage.Expense{}, err
 	}
+	name := fields['P']
+	if name == "" {
+		name = fields['M']
+	}
+	category, classes, _ := strings.Cut(fields['L'], "/")
+	category = storage.SanitizeString(strings.Trim(category, "[]")) // [Account] marks a transfer, ':' a subcategory
+	if category == "" {
+		category = defaultCategory
+	}
+	var tags []string
+	if classes != "" {
+		tags = strings.Split(classes, ":")
+	}
+	return storage.Expense{
+		Name:     name,
+		Category: category,
+		Amount:   amount,
+		Date:     date,
+		Tags:     tags,
+	}, nil
+}
 
-	if len(newCategories) > 0 {
-		if err := h.storage.UpdateCategories(append(currentCategories, newCategories...)); err != nil {
-			log.Printf("Warning: Failed to add new categories to config: %v\n", err)
+// parses a QIF date such as 01/31/2025, 1/31'25 or 1-31-25
+func parseQIFDate(value string, dayFirst bool) (time.Time, error) {
+	normalized := strings.NewReplacer(" ", "", "'", "/", "-", "/", ".", "/").Replace(value)
+	layouts := []string{"1/2/2006", "1/2/06"}
+	if dayFirst {
+		layouts = []string{"2/1/2006", "2/1/06"}
+	}
+	for _, layout := range layouts {
+		if d, err := time.Parse(layout, normalized); err == nil {
+			return d, nil
 		}
 	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"status":          "success",
-		"total_processed": len(records) - 1,
-		"imported":        importedCount,
-		"skipped":         skippedCount,
-		"new_categories":  newCategories,
-	})
-	log.Printf("HTTP: Imported %d expenses from CSV file. Skipped %d records.", importedCount, skippedCount)
+	if d, err := parseDate(value); err == nil {
+		return d, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", value)
 }
 
 // handles importing from ExpenseOwl < v4.0
@@ -225,6 +347,11 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
 		return
 	}
+	mode, err := importMode(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	file, _, err := r.FormFile("file")
 	if err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
@@ -232,17 +359,13 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
-		return
-	}
-	if len(records) < 2 {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
 		return
 	}
 
-	header := records[0]
 	colMap := make(map[string]int)
 	for i, col := range header {
 		colMap[strings.ToLower(strings.TrimSpace(col))] = i
@@ -255,80 +378,491 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	currentCategories, err := h.storage.GetCategories()
+	batch, err := h.newImportBatch(r, mode)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not prepare import"})
+		log.Printf("API ERROR: Failed to prepare CSV import: %v\n", err)
 		return
 	}
-	categorySet := make(map[string]bool)
-	for _, cat := range currentCategories {
-		categorySet[strings.ToLower(cat)] = true
-	}
-	var newCategories []string
-	var importedCount, skippedCount int
-
-	for i, record := range records[1:] {
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			batch.reject(row, nil, err)
+			continue
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+			return
+		}
 		if len(record) != len(header) {
-			log.Printf("Warning: Skipping row %d due to incorrect column count\n", i+2)
-			skippedCount++
+			batch.reject(row, nil, fmt.Errorf("incorrect column count"))
 			continue
 		}
 		amount, err := strconv.ParseFloat(record[colMap["amount"]], 64)
 		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid amount: %s\n", i+2, record[colMap["amount"]])
-			skippedCount++
+			batch.reject(row, nil, fmt.Errorf("invalid amount: %s", record[colMap["amount"]]))
 			continue
 		}
 		date, err := parseDate(record[colMap["date"]])
 		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid date: %v\n", i+2, err)
-			skippedCount++
+			batch.reject(row, nil, fmt.Errorf("invalid date: %v", err))
 			continue
 		}
 		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
-			newCategories = append(newCategories, category)
-			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
-		}
 
 		// switches sign for new expenseowl
 		amountUpdated := amount
 		if category != "Income" {
 			amountUpdated = amount * -1
 		}
-		expense := storage.Expense{
+		batch.add(row, storage.Expense{
 			Name:     strings.TrimSpace(record[colMap["name"]]),
 			Category: category,
 			Amount:   amountUpdated,
 			Date:     date,
+		})
+	}
+	h.commitImport(w, batch, "old CSV file")
+}
+
+// imports conversion rates from a JSON object or a CSV file with 'currency' and 'rate' columns,
+// merging them into the existing rates
+func (h *Handler) ImportConversions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read file"})
+		return
+	}
+
+	imported := map[string]float64{}
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &imported); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to parse JSON file"})
+			return
 		}
-		if err := expense.Validate(); err != nil {
-			log.Printf("Warning: Skipping row %d due to validation error: %v\n", i+2, err)
-			skippedCount++
-			continue
+	} else {
+		records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+			return
 		}
-		if err := h.storage.AddExpense(expense); err != nil {
-			log.Printf("Error: Could not add expense from row %d: %v\n", i+2, err)
-			skippedCount++
-			continue
+		if len(records) < 2 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
+			return
+		}
+		colMap := make(map[string]int)
+		for i, col := range records[0] {
+			colMap[strings.ToLower(strings.TrimSpace(col))] = i
+		}
+		for _, col := range []string{"currency", "rate"} {
+			if _, ok := colMap[col]; !ok {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Missing required column: %s", col)})
+				return
+			}
+		}
+		for i, record := range records[1:] {
+			if len(record) != len(records[0]) {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Incorrect column count in row %d", i+2)})
+				return
+			}
+			rate, err := strconv.ParseFloat(strings.TrimSpace(record[colMap["rate"]]), 64)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid rate in row %d: %s", i+2, record[colMap["rate"]])})
+				return
+			}
+			imported[record[colMap["currency"]]] = rate
+		}
+	}
+	imported, err = storage.ValidateConversions(imported)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	conversions, err := h.ledger(r).GetConversions()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current conversions"})
+		return
+	}
+	maps.Copy(conversions, imported)
+	if err := h.ledger(r).UpdateConversions(conversions); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update conversions"})
+		log.Printf("API ERROR: Failed to update conversions: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":   "success",
+		"imported": len(imported),
+	})
+	log.Printf("HTTP: Imported %d conversion rates", len(imported))
+}
+
+// imports dated exchange rates from CSV, either in long form with 'currency', 'date' and 'rate'
+// columns (rates already in the base currency), or ECB-style wide form with a date column followed
+// by one column per currency quoted against the 'base' form value (default eur)
+func (h *Handler) ImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil { // 32MB max, rate histories can be long
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+		return
+	}
+	if len(records) < 2 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
+		return
+	}
+	baseCurrency, err := h.ledger(r).GetCurrency()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve currency"})
+		return
+	}
+	quoteBase := strings.ToLower(strings.TrimSpace(r.FormValue("base")))
+	if quoteBase == "" {
+		quoteBase = "eur"
+	}
+
+	colMap := make(map[string]int)
+	for i, col := range records[0] {
+		colMap[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	var rates []storage.ExchangeRate
+	var skippedCount int
+	_, hasCurrency := colMap["currency"]
+	_, hasRate := colMap["rate"]
+	if hasCurrency && hasRate {
+		if _, ok := colMap["date"]; !ok {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Missing required column: date"})
+			return
+		}
+		for i, record := range records[1:] {
+			if len(record) < len(records[0]) {
+				log.Printf("Warning: Skipping row %d due to incorrect column count\n", i+2)
+				skippedCount++
+				continue
+			}
+			date, err := parseDate(strings.TrimSpace(record[colMap["date"]]))
+			rate, rateErr := strconv.ParseFloat(strings.TrimSpace(record[colMap["rate"]]), 64)
+			if err != nil || rateErr != nil {
+				log.Printf("Warning: Skipping row %d due to invalid date or rate\n", i+2)
+				skippedCount++
+				continue
+			}
+			rates = append(rates, storage.ExchangeRate{Currency: record[colMap["currency"]], Date: date, Rate: rate})
+		}
+	} else {
+		// wide form: each value is units of the column currency per one unit of the quote base
+		for i, record := range records[1:] {
+			date, err := parseDate(strings.TrimSpace(record[0]))
+			if err != nil {
+				log.Printf("Warning: Skipping row %d due to invalid date: %v\n", i+2, err)
+				skippedCount++
+				continue
+			}
+			quotes := map[string]float64{quoteBase: 1}
+			for j := 1; j < len(record) && j < len(records[0]); j++ {
+				code := strings.ToLower(strings.TrimSpace(records[0][j]))
+				value, err := strconv.ParseFloat(strings.TrimSpace(record[j]), 64)
+				if code == "" || err != nil || value <= 0 {
+					continue // ECB files use N/A for missing quotes and end rows with an empty column
+				}
+				quotes[code] = value
+			}
+			baseQuote, ok := quotes[baseCurrency]
+			if !ok {
+				log.Printf("Warning: Skipping row %d, no quote for base currency %s\n", i+2, baseCurrency)
+				skippedCount++
+				continue
+			}
+			for code, value := range quotes {
+				if code == baseCurrency || !slices.Contains(storage.SupportedCurrencies, code) {
+					continue
+				}
+				rates = append(rates, storage.ExchangeRate{Currency: code, Date: date, Rate: baseQuote / value})
+			}
+		}
+	}
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if err := h.ledger(r).AddExchangeRates(rates); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save exchange rates"})
+		log.Printf("API ERROR: Failed to save exchange rates: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":   "success",
+		"imported": len(rates),
+		"skipped":  skippedCount,
+	})
+	log.Printf("HTTP: Imported %d exchange rates. Skipped %d rows.", len(rates), skippedCount)
+}
+
+// how an import treats rows that cannot be imported
+const (
+	importModePartial = "partial" // skip invalid rows and import the rest
+	importModeAtomic  = "atomic"  // import nothing if any row is invalid
+)
+
+// outcomes of a row of an imported file
+const (
+	importRowValid   = "valid"   // imported, or would be on a dry run
+	importRowInvalid = "invalid" // could not be parsed or failed validation
+	importRowSkipped = "skipped" // valid but left out, such as an expense that already exists or likely duplicates one
+)
+
+// how likely a suggested category must be for an imported row without one to take it
+const minImportSuggestionConfidence = 0.6
+
+// diagnostics for one row of an imported file
+type importRow struct {
+	Row     int              `json:"row"`
+	Status  string           `json:"status"`
+	Expense *storage.Expense `json:"expense,omitempty"` // as parsed, missing when the row could not be parsed
+	Error   string           `json:"error,omitempty"`
+}
+
+// expenses parsed from an imported file, validated and collected so they can be stored at once
+type importBatch struct {
+	store         storage.Storage
+	mode          string
+	dryRun        bool               // report what would be imported without storing anything
+	allowDupes    bool               // import expenses that look like ones the ledger already has
+	rules         *storage.RuleSet   // nil when rules are not applied
+	suggester     *storage.Suggester // learned from the ledger's expenses
+	existingIDs   map[string]bool
+	duplicates    *storage.DuplicateIndex // the ledger's expenses
+	matched       map[string]bool         // IDs of expenses an imported row already duplicates
+	currency      string
+	category      string // given to rows without a category and without a confident suggestion
+	categories    []string
+	categorySet   map[string]bool
+	newCategories []string
+	expenses      []storage.Expense
+	rows          []importRow
+	invalid       int
+	skipped       int
+}
+
+// reads the 'mode' form value, defaulting to a partial import
+func importMode(r *http.Request) (string, error) {
+	switch mode := r.FormValue("mode"); mode {
+	case "", importModePartial:
+		return importModePartial, nil
+	case importModeAtomic:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid import mode: '%s'. Must be 'partial' or 'atomic'", mode)
+	}
+}
+
+// reads the 'category' form value given to transactions of files without categories
+func importCategory(r *http.Request) string {
+	if category := storage.SanitizeString(r.FormValue("category")); category != "" {
+		return category
+	}
+	return "Uncategorized"
+}
+
+// reads the 'dryRun' form value
+func importDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.FormValue("dryRun"))
+	return dryRun
+}
+
+// reads the 'allowDuplicates' form value
+func importAllowDuplicates(r *http.Request) bool {
+	allow, _ := strconv.ParseBool(r.FormValue("allowDuplicates"))
+	return allow
+}
+
+// reads the 'applyRules' form value, category rules apply unless it is false
+func importApplyRules(r *http.Request) bool {
+	apply, err := strconv.ParseBool(r.FormValue("applyRules"))
+	return apply || err != nil
+}
+
+// prepares a batch for the request's ledger with the request's import options
+func (h *Handler) newImportBatch(r *http.Request, mode string) (*importBatch, error) {
+	var err error
+	store := h.ledger(r)
+	batch := &importBatch{store: store, mode: mode, dryRun: importDryRun(r), allowDupes: importAllowDuplicates(r), category: importCategory(r), matched: map[string]bool{}}
+	if importApplyRules(r) {
+		if batch.rules, err = ledgerRuleSet(store); err != nil {
+			return nil, err
+		}
+	}
+	if batch.currency, err = store.GetCurrency(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve currency: %v", err)
+	}
+	if batch.categories, err = store.GetCategories(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve categories: %v", err)
+	}
+	batch.categorySet = make(map[string]bool)
+	for _, cat := range batch.categories {
+		batch.categorySet[strings.ToLower(cat)] = true
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve expenses: %v", err)
+	}
+	batch.existingIDs = make(map[string]bool, len(expenses))
+	for _, e := range expenses {
+		batch.existingIDs[e.ID] = true
+	}
+	batch.duplicates = storage.NewDuplicateIndex(expenses)
+	batch.suggester = storage.NewSuggester(expenses)
+	return batch, nil
+}
+
+// categorizes an expense by the ledger's rules, or if it has no category by the category of similar
+// past expenses when the suggestion is confident enough and the default category otherwise, validates
+// it and queues it, noting categories the ledger doesn't have yet
+func (b *importBatch) add(row int, expense storage.Expense) {
+	if expense.Currency == "" {
+		expense.Currency = b.currency
+	}
+	if b.rules != nil {
+		b.rules.Apply(&expense)
+	}
+	if expense.Category == "" {
+		expense.Category = b.category
+		if suggestion := b.suggester.Suggest(expense.Name); suggestion.Confidence >= minImportSuggestionConfidence {
+			expense.Category = suggestion.Category
+		}
+	}
+	if err := expense.Validate(); err != nil {
+		b.reject(row, &expense, fmt.Errorf("validation error: %v", err))
+		return
+	}
+	if !b.allowDupes {
+		// each existing expense stands for one row only, so a file with the same purchase twice
+		// imports the second one
+		if pairs := b.duplicates.Find(expense, b.matched); len(pairs) > 0 {
+			match := pairs[0].Expense
+			b.matched[match.ID] = true
+			b.skip(row, &expense, fmt.Sprintf("possible duplicate of '%s' on %s (%s)", match.Name, match.Date.Format("2006-01-02"), match.ID))
+			return
 		}
-		importedCount++
-		time.Sleep(10 * time.Millisecond)
 	}
+	if !b.categorySet[strings.ToLower(expense.Category)] {
+		b.newCategories = append(b.newCategories, expense.Category)
+		b.categorySet[strings.ToLower(expense.Category)] = true // Add to set to handle duplicates in the same file
+	}
+	b.expenses = append(b.expenses, expense)
+	b.rows = append(b.rows, importRow{Row: row, Status: importRowValid, Expense: &expense})
+}
+
+// records a row that is invalid, which fails an atomic import; expense is nil if it couldn't be parsed
+func (b *importBatch) reject(row int, expense *storage.Expense, err error) {
+	log.Printf("Warning: Skipping row %d due to %v\n", row, err)
+	b.rows = append(b.rows, importRow{Row: row, Status: importRowInvalid, Expense: expense, Error: err.Error()})
+	b.invalid++
+}
+
+// records a valid row that is left out on purpose, such as an expense that already exists
+func (b *importBatch) skip(row int, expense *storage.Expense, reason string) {
+	log.Printf("Info: Skipping row %d because %s\n", row, reason)
+	b.rows = append(b.rows, importRow{Row: row, Status: importRowSkipped, Expense: expense, Error: reason})
+	b.skipped++
+}
+
+// rows with the given status
+func (b *importBatch) rowsWith(status string) []importRow {
+	rows := []importRow{}
+	for _, row := range b.rows {
+		if row.Status == status {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
 
-	if len(newCategories) > 0 {
-		if err := h.storage.UpdateCategories(append(currentCategories, newCategories...)); err != nil {
+// stores every queued expense with a single AddMultipleExpenses call and reports the outcome;
+// a dry run reports every row instead and stores nothing
+func (h *Handler) commitImport(w http.ResponseWriter, b *importBatch, source string) {
+	if len(b.rows) == 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("No transactions found in %s", source)})
+		return
+	}
+	if b.dryRun {
+		imported := len(b.expenses)
+		if b.mode == importModeAtomic && b.invalid > 0 {
+			imported = 0
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":          "preview",
+			"mode":            b.mode,
+			"total_processed": len(b.rows),
+			"imported":        imported,
+			"invalid":         b.invalid,
+			"skipped":         b.skipped + b.invalid,
+			"new_categories":  b.newCategories,
+			"rows":            b.rows,
+		})
+		log.Printf("HTTP: Previewed import of %d expenses from %s. %d invalid records.", len(b.expenses), source, b.invalid)
+		return
+	}
+	if b.mode == importModeAtomic && b.invalid > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":  fmt.Sprintf("Import aborted, %d rows are invalid", b.invalid),
+			"errors": b.rowsWith(importRowInvalid),
+		})
+		return
+	}
+	if err := b.store.AddMultipleExpenses(b.expenses); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to import expenses"})
+		log.Printf("API ERROR: Failed to import expenses from %s: %v\n", source, err)
+		return
+	}
+	if len(b.newCategories) > 0 {
+		if err := b.store.UpdateCategories(append(b.categories, b.newCategories...)); err != nil {
 			log.Printf("Warning: Failed to add new categories to config: %v\n", err)
 		}
 	}
 	writeJSON(w, http.StatusOK, map[string]any{
 		"status":          "success",
-		"total_processed": len(records) - 1,
-		"imported":        importedCount,
-		"skipped":         skippedCount,
-		"new_categories":  newCategories,
+		"total_processed": len(b.rows),
+		"imported":        len(b.expenses),
+		"skipped":         b.skipped + b.invalid,
+		"new_categories":  b.newCategories,
 	})
-	log.Printf("HTTP: Imported %d expenses from CSV file. Skipped %d records.", importedCount, skippedCount)
+	log.Printf("HTTP: Imported %d expenses from %s. Skipped %d records.", len(b.expenses), source, b.skipped+b.invalid)
 }
 
 func parseDate(dateStr string) (time.Time, error) {
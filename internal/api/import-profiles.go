@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func (h *Handler) GetImportProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	profiles, err := h.ledger(r).GetImportProfiles()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get import profiles"})
+		log.Printf("API ERROR: Failed to get import profiles: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+func (h *Handler) AddImportProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var profile storage.ImportProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := profile.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	profile, err := h.ledger(r).AddImportProfile(profile)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to add import profile: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, profile)
+}
+
+func (h *Handler) UpdateImportProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	var profile storage.ImportProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := profile.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.ledger(r).UpdateImportProfile(id, profile); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to update import profile: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handler) DeleteImportProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if err := h.ledger(r).RemoveImportProfile(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete import profile"})
+		log.Printf("API ERROR: Failed to delete import profile: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// profile for ExpenseOwl's own CSV export, used when the upload doesn't select a saved profile
+var defaultImportProfile = storage.ImportProfile{
+	Name:      "ExpenseOwl CSV",
+	Delimiter: ",",
+	Decimal:   ".",
+	Columns:   storage.ImportColumns{Name: "name", Category: "category", Amount: "amount", Date: "date"},
+}
+
+// positions of a profile's columns in a file's header, -1 for columns the file doesn't have
+type importColumnIndex struct {
+	name, category, amount, debit, credit, date, currency, tags, id int
+}
+
+// returns the saved profile selected by the 'profile' form value, or the default profile
+func (h *Handler) importProfile(r *http.Request) (storage.ImportProfile, error) {
+	id := r.FormValue("profile")
+	if id == "" {
+		return defaultImportProfile, nil
+	}
+	profiles, err := h.ledger(r).GetImportProfiles()
+	if err != nil {
+		return storage.ImportProfile{}, fmt.Errorf("could not retrieve import profiles")
+	}
+	for _, p := range profiles {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return storage.ImportProfile{}, fmt.Errorf("import profile with ID %s not found", id)
+}
+
+// finds the profile's columns in the header by name, ignoring case; currency, tags and ID columns
+// the profile doesn't map are picked up when the header has them under their own names
+func resolveImportColumns(header []string, profile storage.ImportProfile) (importColumnIndex, error) {
+	positions := make(map[string]int)
+	for i, col := range header {
+		if i == 0 {
+			col = strings.TrimPrefix(col, "\ufeff") // byte order mark some spreadsheet exports start with
+		}
+		positions[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	var missing error
+	find := func(column, fallback string) int {
+		if column == "" {
+			if i, ok := positions[fallback]; ok && fallback != "" {
+				return i
+			}
+			return -1
+		}
+		i, ok := positions[strings.ToLower(column)]
+		if !ok {
+			if missing == nil {
+				missing = fmt.Errorf("Missing required column: %s", column)
+			}
+			return -1
+		}
+		return i
+	}
+	c := profile.Columns
+	cols := importColumnIndex{
+		name:     find(c.Name, ""),
+		category: find(c.Category, ""),
+		amount:   find(c.Amount, ""),
+		debit:    find(c.Debit, ""),
+		credit:   find(c.Credit, ""),
+		date:     find(c.Date, ""),
+		currency: find(c.Currency, "currency"),
+		tags:     find(c.Tags, "tags"),
+		id:       find("", "id"),
+	}
+	return cols, missing
+}
+
+// builds an expense from a row with the profile's columns and formats; debit and credit columns
+// hold unsigned amounts going out and coming in
+func parseImportRow(record []string, cols importColumnIndex, profile *storage.ImportProfile) (storage.Expense, error) {
+	value := func(i int) string {
+		if i < 0 {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	var amount float64
+	if cols.amount >= 0 {
+		parsed, err := profile.ParseAmount(value(cols.amount))
+		if err != nil {
+			return storage.Expense{}, err
+		}
+		amount = parsed
+	} else {
+		debit, credit := value(cols.debit), value(cols.credit)
+		if debit == "" && credit == "" {
+			return storage.Expense{}, fmt.Errorf("row has neither a debit nor a credit amount")
+		}
+		if debit != "" {
+			parsed, err := profile.ParseAmount(debit)
+			if err != nil {
+				return storage.Expense{}, err
+			}
+			amount -= math.Abs(parsed)
+		}
+		if credit != "" {
+			parsed, err := profile.ParseAmount(credit)
+			if err != nil {
+				return storage.Expense{}, err
+			}
+			amount += math.Abs(parsed)
+		}
+	}
+	if profile.InvertSign {
+		amount = -amount
+	}
+
+	var date time.Time
+	var err error
+	if layout := profile.DateLayout(); layout != "" {
+		if date, err = time.Parse(layout, value(cols.date)); err != nil {
+			return storage.Expense{}, fmt.Errorf("invalid date: '%s' does not match %s", value(cols.date), profile.DateFormat)
+		}
+	} else if date, err = parseDate(value(cols.date)); err != nil {
+		return storage.Expense{}, fmt.Errorf("invalid date: %v", err)
+	}
+
+	category := value(cols.category)
+	if category == "" {
+		category = profile.DefaultCategory
+	}
+	var tags []string
+	if tagsStr := value(cols.tags); tagsStr != "" {
+		tags = strings.Split(tagsStr, ",")
+		for i := range tags {
+			tags[i] = strings.TrimSpace(tags[i])
+		}
+	}
+	return storage.Expense{
+		Name:     value(cols.name),
+		Category: category,
+		Amount:   amount,
+		Currency: strings.ToLower(value(cols.currency)),
+		Date:     date,
+		Tags:     tags,
+	}, nil
+}
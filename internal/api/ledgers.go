@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+const (
+	ledgerHeaderName = "X-Ledger-ID"
+	ledgerCookieName = "expenseowl_ledger" // set by the UI's ledger selector
+)
+
+const (
+	ledgerContextKey   contextKey = "ledger"
+	ledgerIDContextKey contextKey = "ledgerID"
+)
+
+// ledger as returned by the API, with usernames resolved
+type ledgerView struct {
+	storage.Ledger
+	Owner       string   `json:"owner"`
+	MemberNames []string `json:"memberNames"`
+	CanManage   bool     `json:"canManage"`
+}
+
+type ledgerRequest struct {
+	Name     string   `json:"name"`
+	Currency string   `json:"currency"`
+	Members  []string `json:"members"` // usernames
+}
+
+// serves the request as the user, scoped to the ledger selected by the X-Ledger-ID header or 'ledger'
+// parameter, falling back to the UI's ledger cookie and then the default ledger
+func (h *Handler) serveAs(w http.ResponseWriter, r *http.Request, next http.Handler, user storage.User) {
+	id := r.Header.Get(ledgerHeaderName)
+	if id == "" {
+		id = r.URL.Query().Get("ledger")
+	}
+	explicit := id != ""
+	if !explicit {
+		if cookie, err := r.Cookie(ledgerCookieName); err == nil {
+			id = cookie.Value
+		}
+	}
+	if id == "" {
+		id = storage.DefaultLedgerID
+	}
+	ledger, err := h.storage.GetLedger(id)
+	if (err != nil || !ledger.CanAccess(user)) && !explicit {
+		// a stale selection from a removed or unshared ledger
+		id = storage.DefaultLedgerID
+		ledger, err = h.storage.GetLedger(id)
+	}
+	if err != nil || !ledger.CanAccess(user) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Ledger not found"})
+		return
+	}
+	store, err := h.storage.WithLedger(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to open ledger"})
+		log.Printf("API ERROR: Failed to open ledger %s: %v\n", id, err)
+		return
+	}
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	ctx = context.WithValue(ctx, ledgerContextKey, store)
+	ctx = context.WithValue(ctx, ledgerIDContextKey, id)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// returns the storage scoped to the request's ledger
+func (h *Handler) ledger(r *http.Request) storage.Storage {
+	if store, ok := r.Context().Value(ledgerContextKey).(storage.Storage); ok {
+		return store
+	}
+	return h.storage
+}
+
+// returns the ID of the request's ledger
+func ledgerID(r *http.Request) string {
+	if id, ok := r.Context().Value(ledgerIDContextKey).(string); ok {
+		return id
+	}
+	return storage.DefaultLedgerID
+}
+
+// maps usernames to user IDs
+func (h *Handler) memberIDs(usernames []string) ([]string, error) {
+	ids := []string{}
+	for _, name := range usernames {
+		user, err := h.storage.GetUserByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown user: %s", name)
+		}
+		ids = append(ids, user.ID)
+	}
+	return ids, nil
+}
+
+func (h *Handler) ledgerViews(ledgers []storage.Ledger, user storage.User) ([]ledgerView, error) {
+	users, err := h.storage.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	views := []ledgerView{}
+	for _, l := range ledgers {
+		if !l.CanAccess(user) {
+			continue
+		}
+		view := ledgerView{Ledger: l, Owner: names[l.OwnerID], MemberNames: []string{}, CanManage: l.CanManage(user)}
+		for _, id := range l.Members {
+			view.MemberNames = append(view.MemberNames, names[id])
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// returns the ledgers the signed-in user can access
+func (h *Handler) GetLedgers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	ledgers, err := h.storage.GetLedgers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get ledgers"})
+		log.Printf("API ERROR: Failed to get ledgers: %v\n", err)
+		return
+	}
+	user, _ := currentUser(r)
+	views, err := h.ledgerViews(ledgers, user)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get ledgers"})
+		log.Printf("API ERROR: Failed to get ledger users: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// creates a ledger owned by the signed-in user
+func (h *Handler) AddLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req ledgerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	members, err := h.memberIDs(req.Members)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	user, _ := currentUser(r)
+	ledger, err := h.storage.AddLedger(storage.Ledger{Name: req.Name, OwnerID: user.ID, Members: members})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to add ledger: %v\n", err)
+		return
+	}
+	if req.Currency != "" {
+		store, err := h.storage.WithLedger(ledger.ID)
+		if err == nil {
+			err = store.UpdateCurrency(req.Currency)
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			log.Printf("API ERROR: Failed to set ledger currency: %v\n", err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, ledger)
+}
+
+// renames a ledger or changes who it is shared with
+func (h *Handler) UpdateLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	var req ledgerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if _, ok := h.manageableLedger(w, r, id); !ok {
+		return
+	}
+	members, err := h.memberIDs(req.Members)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.storage.UpdateLedger(id, storage.Ledger{Name: req.Name, Members: members}); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to update ledger: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// removes a ledger along with all of its data
+func (h *Handler) DeleteLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if _, ok := h.manageableLedger(w, r, id); !ok {
+		return
+	}
+	if err := h.storage.RemoveLedger(id); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to delete ledger: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// writes an error and returns false unless the signed-in user can manage the ledger
+func (h *Handler) manageableLedger(w http.ResponseWriter, r *http.Request, id string) (storage.Ledger, bool) {
+	user, _ := currentUser(r)
+	ledger, err := h.storage.GetLedger(id)
+	if err != nil || !ledger.CanAccess(user) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Ledger not found"})
+		return storage.Ledger{}, false
+	}
+	if !ledger.CanManage(user) {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Only the ledger owner can change it"})
+		return storage.Ledger{}, false
+	}
+	return ledger, true
+}
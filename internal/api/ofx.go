@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// namespace for expense IDs derived from OFX transaction IDs, so importing the same statement twice
+// finds the expenses of the first import
+var ofxNamespace = uuid.MustParse("6f1c2e0a-3b7d-5c48-9a21-0e8f4d6b7c35")
+
+// transaction of an OFX statement, with the account and currency of the statement it is listed in
+type ofxTransaction struct {
+	account  string
+	currency string
+	fitID    string // the bank's unique ID for the transaction within the account
+	trnType  string
+	posted   string
+	amount   string
+	name     string
+	memo     string
+}
+
+// imports expenses from an OFX or QFX bank statement
+func (h *Handler) ImportOFX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	mode, err := importMode(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read file"})
+		return
+	}
+	transactions, err := parseOFX(content)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if len(transactions) == 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "OFX file has no transactions"})
+		return
+	}
+	batch, err := h.newImportBatch(r, mode)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not prepare import"})
+		log.Printf("API ERROR: Failed to prepare OFX import: %v\n", err)
+		return
+	}
+
+	category := importCategory(r) // OFX has no categories
+	ledger := ledgerID(r)
+	for i, t := range transactions {
+		row := i + 1
+		expense, err := t.expense(category)
+		if err != nil {
+			batch.reject(row, nil, err)
+			continue
+		}
+		if t.fitID != "" {
+			expense.ID = uuid.NewSHA1(ofxNamespace, []byte(ledger+"/"+t.account+"/"+t.fitID)).String()
+			if batch.existingIDs[expense.ID] {
+				batch.skip(row, nil, fmt.Sprintf("transaction '%s' was already imported", t.fitID))
+				continue
+			}
+			batch.existingIDs[expense.ID] = true // banks repeat transactions in overlapping statements of one file
+		}
+		batch.add(row, expense)
+	}
+	h.commitImport(w, batch, "OFX file")
+}
+
+// reads the transactions of every bank and credit card statement in an OFX file, either OFX 1.x
+// SGML, where elements holding a value have no end tag, or OFX 2.x XML
+func parseOFX(content []byte) ([]ofxTransaction, error) {
+	start := bytes.Index(bytes.ToUpper(content), []byte("<OFX>"))
+	if start < 0 {
+		return nil, fmt.Errorf("not an OFX file: missing <OFX> element")
+	}
+	var transactions []ofxTransaction
+	var account, currency string
+	var current *ofxTransaction
+	rest := content[start:]
+	for len(rest) > 0 {
+		open := bytes.IndexByte(rest, '<')
+		if open < 0 {
+			break
+		}
+		end := bytes.IndexByte(rest[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("malformed OFX file: unterminated tag")
+		}
+		tag := strings.ToUpper(strings.TrimSpace(string(rest[open+1 : open+end])))
+		rest = rest[open+end+1:]
+		if tag == "" || tag[0] == '?' || tag[0] == '!' {
+			continue // XML declaration, OFX processing instruction or comment
+		}
+		if tag[0] == '/' {
+			if tag == "/STMTTRN" && current != nil {
+				transactions = append(transactions, *current)
+				current = nil
+			}
+			continue
+		}
+		if i := strings.IndexAny(tag, " \t\r\n"); i >= 0 {
+			tag = tag[:i] // attributes are not used by OFX, but are allowed in 2.x
+		}
+		// an element's value runs to the next tag, which is its end tag in XML
+		next := bytes.IndexByte(rest, '<')
+		if next < 0 {
+			next = len(rest)
+		}
+		value := html.UnescapeString(strings.TrimSpace(string(rest[:next])))
+		switch tag {
+		case "STMTTRN":
+			if current != nil { // SGML files may leave aggregates unclosed too
+				transactions = append(transactions, *current)
+			}
+			current = &ofxTransaction{account: account, currency: currency}
+		case "ACCTID":
+			if current == nil { // a transfer's BANKACCTTO names the other account
+				account = value
+			}
+		case "CURDEF":
+			currency = strings.ToLower(value)
+		}
+		if current == nil || value == "" {
+			continue
+		}
+		switch tag {
+		case "FITID":
+			current.fitID = value
+		case "TRNTYPE":
+			current.trnType = value
+		case "DTPOSTED":
+			current.posted = value
+		case "TRNAMT":
+			current.amount = value
+		case "NAME":
+			current.name = value
+		case "MEMO":
+			current.memo = value
+		}
+	}
+	if current != nil {
+		transactions = append(transactions, *current)
+	}
+	return transactions, nil
+}
+
+// builds an expense from the transaction; OFX amounts are already negative for money going out
+func (t ofxTransaction) expense(category string) (storage.Expense, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(t.amount, ",", "."), 64)
+	if err != nil {
+		return storage.Expense{}, fmt.Errorf("invalid amount: %s", t.amount)
+	}
+	date, err := parseOFXDate(t.posted)
+	if err != nil {
+		return storage.Expense{}, err
+	}
+	name := t.name
+	if name == "" {
+		name = t.memo
+	}
+	if name == "" {
+		name = t.trnType
+	}
+	return storage.Expense{
+		Name:     name,
+		Category: category,
+		Amount:   amount,
+		Currency: t.currency,
+		Date:     date,
+	}, nil
+}
+
+// parses an OFX date, YYYYMMDD optionally followed by HHMMSS, milliseconds and a time zone offset
+// in hours such as [-5:EST]
+func parseOFXDate(value string) (time.Time, error) {
+	invalid := fmt.Errorf("invalid date: %s", value)
+	offset := 0
+	if i := strings.IndexByte(value, '['); i >= 0 {
+		zone := strings.TrimSuffix(value[i+1:], "]")
+		if j := strings.IndexByte(zone, ':'); j >= 0 {
+			zone = zone[:j]
+		}
+		hours, err := strconv.ParseFloat(zone, 64)
+		if err != nil {
+			return time.Time{}, invalid
+		}
+		offset = int(hours * 3600)
+		value = value[:i]
+	}
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		value = value[:i]
+	}
+	layout := "20060102150405"
+	if len(value) < 8 || len(value) > len(layout) {
+		return time.Time{}, invalid
+	}
+	date, err := time.ParseInLocation(layout[:len(value)], value, time.FixedZone("", offset))
+	if err != nil {
+		return time.Time{}, invalid
+	}
+	return date.UTC(), nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// returns totals for a period; either period (+ optional date and tz) or from/to must be given
+func (h *Handler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	from, to, err := h.parsePeriod(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	summary, err := h.ledger(r).GetSummary(from, to)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute summary"})
+		log.Printf("API ERROR: Failed to compute summary: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// returns who owes whom across the ledger's split expenses, with suggested transfers to settle up
+func (h *Handler) GetBalances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	balances, err := storage.GetBalances(h.ledger(r))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute balances"})
+		log.Printf("API ERROR: Failed to compute balances: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, balances)
+}
+
+// resolves the report range from URL parameters, defaulting to the current start-date aligned month
+func (h *Handler) parsePeriod(r *http.Request) (time.Time, time.Time, error) {
+	params := r.URL.Query()
+	loc, err := parseLocation(r)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if params.Get("from") != "" || params.Get("to") != "" {
+		from, err := parseDate(params.Get("from"))
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid 'from' date: %s", params.Get("from"))
+		}
+		to, err := parseDate(params.Get("to"))
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid 'to' date: %s", params.Get("to"))
+		}
+		if len(params.Get("to")) <= len("2006-01-02") {
+			to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		if to.Before(from) {
+			return time.Time{}, time.Time{}, fmt.Errorf("'to' date cannot be before 'from' date")
+		}
+		return from, to, nil
+	}
+	ref, err := parseReference(r, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	period := params.Get("period")
+	if period == "" {
+		period = storage.PeriodMonth
+	}
+	startDate, err := h.ledger(r).GetStartDate()
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("could not retrieve start date")
+	}
+	return storage.PeriodBounds(period, ref, startDate)
+}
+
+// returns the location named by the 'tz' parameter, defaulting to UTC
+func parseLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone: %s", tz)
+	}
+	return loc, nil
+}
+
+// returns the day named by the 'date' parameter in loc, defaulting to now
+func parseReference(r *http.Request, loc *time.Location) (time.Time, error) {
+	v := r.URL.Query().Get("date")
+	if v == "" {
+		return time.Now().In(loc), nil
+	}
+	ref, err := time.ParseInLocation("2006-01-02", v, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid 'date': %s", v)
+	}
+	return ref, nil
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// how many expenses a rule matches first and how many of them it would change
+type ruleEffect struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Matches int    `json:"matches"`
+	Changes int    `json:"changes"`
+}
+
+func (h *Handler) GetCategoryRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	rules, err := h.ledger(r).GetCategoryRules()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get category rules"})
+		log.Printf("API ERROR: Failed to get category rules: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (h *Handler) AddCategoryRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var rule storage.CategoryRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rule, err := h.ledger(r).AddCategoryRule(rule)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to add category rule: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (h *Handler) UpdateCategoryRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	var rule storage.CategoryRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.ledger(r).UpdateCategoryRule(id, rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to update category rule: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (h *Handler) DeleteCategoryRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if err := h.ledger(r).RemoveCategoryRule(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete category rule"})
+		log.Printf("API ERROR: Failed to delete category rule: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// reports how many existing expenses each rule would change if the rules were re-applied
+func (h *Handler) PreviewCategoryRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	effects, changed, err := reapplyRules(h.ledger(r))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to preview category rules"})
+		log.Printf("API ERROR: Failed to preview category rules: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":  "preview",
+		"changes": len(changed),
+		"rules":   effects,
+	})
+}
+
+// re-applies the rules to every existing expense, adding the categories they assign to the ledger
+func (h *Handler) ApplyCategoryRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	store := h.ledger(r)
+	effects, changed, err := reapplyRules(store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply category rules"})
+		log.Printf("API ERROR: Failed to apply category rules: %v\n", err)
+		return
+	}
+	if err := store.UpdateExpenses(changed); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply category rules"})
+		log.Printf("API ERROR: Failed to update expenses with category rules: %v\n", err)
+		return
+	}
+	if err := addMissingCategories(store, changed); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply category rules"})
+		log.Printf("API ERROR: Failed to add categories of category rules: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":  "success",
+		"changes": len(changed),
+		"rules":   effects,
+	})
+	log.Printf("HTTP: Re-applied category rules to %d expenses\n", len(changed))
+}
+
+// applies the ledger's rules to copies of its expenses and returns the effect of each rule with the
+// expenses that changed
+func reapplyRules(store storage.Storage) ([]ruleEffect, []storage.Expense, error) {
+	rules, err := ledgerRuleSet(store)
+	if err != nil {
+		return nil, nil, err
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve expenses: %v", err)
+	}
+	effects := make([]ruleEffect, len(rules.Rules()))
+	for i, rule := range rules.Rules() {
+		effects[i] = ruleEffect{ID: rule.ID, Name: rule.Name}
+	}
+	var changed []storage.Expense
+	for _, original := range expenses {
+		expense := original
+		i := rules.Apply(&expense)
+		if i < 0 {
+			continue
+		}
+		effects[i].Matches++
+		if expense.Category != original.Category || len(expense.Tags) != len(original.Tags) {
+			effects[i].Changes++
+			changed = append(changed, expense)
+		}
+	}
+	return effects, changed, nil
+}
+
+// categorizes a new expense by the ledger's rules; the caller adds the category it gets to the
+// ledger once the expense is stored
+func applyCategoryRules(store storage.Storage, expense *storage.Expense) error {
+	rules, err := ledgerRuleSet(store)
+	if err != nil {
+		return err
+	}
+	if expense.Currency == "" {
+		if expense.Currency, err = store.GetCurrency(); err != nil {
+			return err
+		}
+	}
+	rules.Apply(expense)
+	return nil
+}
+
+func ledgerRuleSet(store storage.Storage) (*storage.RuleSet, error) {
+	rules, err := store.GetCategoryRules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve category rules: %v", err)
+	}
+	return storage.NewRuleSet(rules)
+}
+
+// adds the categories of the expenses the ledger doesn't have yet
+func addMissingCategories(store storage.Storage, expenses []storage.Expense) error {
+	categories, err := store.GetCategories()
+	if err != nil {
+		return err
+	}
+	updated := slices.Clone(categories)
+	for _, e := range expenses {
+		if !slices.ContainsFunc(updated, func(c string) bool { return strings.EqualFold(c, e.Category) }) {
+			updated = append(updated, e.Category)
+		}
+	}
+	if len(updated) == len(categories) {
+		return nil
+	}
+	return store.UpdateCategories(updated)
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// suggests a category and tags for the 'name' parameter, learned from the ledger's expenses
+func (h *Handler) GetSuggestion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "name parameter is required"})
+		return
+	}
+	expenses, err := h.ledger(r).GetAllExpenses()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, storage.NewSuggester(expenses).Suggest(name))
+}
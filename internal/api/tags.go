@@ -0,0 +1,233 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// a tag of the ledger with how many expenses and recurring expenses carry it; tags that expenses
+// carry without being registered are listed too
+type tagUsage struct {
+	Name              string `json:"name"`
+	Color             string `json:"color"`
+	Registered        bool   `json:"registered"`
+	Expenses          int    `json:"expenses"`
+	RecurringExpenses int    `json:"recurringExpenses"`
+}
+
+// lists the registered tags in their order, followed by the unregistered ones by name
+func (h *Handler) GetTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	tags, err := ledgerTags(h.ledger(r))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get tags"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// replaces the tag registry, to add, reorder or recolor tags; tags left out are not stripped from
+// expenses
+func (h *Handler) UpdateTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var tags []storage.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tags); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	tags, err := storage.ValidateTags(tags)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.ledger(r).UpdateTags(tags); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update tags"})
+		log.Printf("API ERROR: Failed to update tags: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// renames a tag on every expense, recurring expense, budget and category rule using it
+func (h *Handler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	store := h.ledger(r)
+	tags, err := ledgerTags(store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename tag"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	to := storage.SanitizeString(req.To)
+	if to == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "tag name cannot be empty"})
+		return
+	}
+	if findTag(tags, req.From) == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("tag %s not found", req.From)})
+		return
+	}
+	// changing only the case of a tag is a rename, anything else that exists has to be merged
+	if !strings.EqualFold(req.From, to) && findTag(tags, to) != nil {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("tag %s already exists, merge the tags instead", to)})
+		return
+	}
+	if err := store.RenameTag(req.From, to); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename tag"})
+		log.Printf("API ERROR: Failed to rename tag: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	log.Printf("HTTP: Renamed tag %s to %s\n", req.From, to)
+}
+
+// merges a tag into another, replacing it wherever it is used and dropping it from the registry
+func (h *Handler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req struct {
+		From string `json:"from"`
+		Into string `json:"into"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if strings.EqualFold(req.From, req.Into) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "cannot merge a tag into itself"})
+		return
+	}
+	store := h.ledger(r)
+	tags, err := ledgerTags(store)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge tags"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	from, into := findTag(tags, req.From), findTag(tags, req.Into)
+	if from == nil || into == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Both tags must exist"})
+		return
+	}
+	budgets, err := store.GetBudgets()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge tags"})
+		log.Printf("API ERROR: Failed to get budgets: %v\n", err)
+		return
+	}
+	// a tag can only have one budget, so one of the two has to go first
+	if tagHasBudget(budgets, from.Name) && tagHasBudget(budgets, into.Name) {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Both tags have a budget, delete one of them first"})
+		return
+	}
+	if err := store.RenameTag(from.Name, into.Name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge tags"})
+		log.Printf("API ERROR: Failed to merge tags: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	log.Printf("HTTP: Merged tag %s into %s\n", from.Name, into.Name)
+}
+
+// removes a tag from the registry and strips it from expenses, recurring expenses and the tags
+// category rules add; a tag with a budget cannot be deleted until the budget is
+func (h *Handler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "name parameter is required"})
+		return
+	}
+	store := h.ledger(r)
+	budgets, err := store.GetBudgets()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete tag"})
+		log.Printf("API ERROR: Failed to get budgets: %v\n", err)
+		return
+	}
+	if tagHasBudget(budgets, name) {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("tag %s has a budget, delete the budget first", name)})
+		return
+	}
+	if err := store.RemoveTag(name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete tag"})
+		log.Printf("API ERROR: Failed to delete tag: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// the registered tags and those only expenses carry, matched case-insensitively, with their usage
+func ledgerTags(store storage.Storage) ([]tagUsage, error) {
+	registry, err := store.GetTags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve tags: %v", err)
+	}
+	counts, err := store.GetTagCounts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tags: %v", err)
+	}
+	tags := make([]tagUsage, 0, len(registry))
+	for _, t := range registry {
+		tags = append(tags, tagUsage{Name: t.Name, Color: t.Color, Registered: true})
+	}
+	registered := len(tags)
+	usage := func(name string) *tagUsage {
+		if t := findTag(tags, name); t != nil {
+			return t
+		}
+		tags = append(tags, tagUsage{Name: name})
+		return &tags[len(tags)-1]
+	}
+	for _, c := range counts {
+		t := usage(c.Name)
+		t.Expenses += c.Expenses
+		t.RecurringExpenses += c.RecurringExpenses
+	}
+	slices.SortFunc(tags[registered:], func(a, b tagUsage) int {
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return tags, nil
+}
+
+func findTag(tags []tagUsage, name string) *tagUsage {
+	i := slices.IndexFunc(tags, func(t tagUsage) bool { return strings.EqualFold(t.Name, name) })
+	if i < 0 {
+		return nil
+	}
+	return &tags[i]
+}
+
+func tagHasBudget(budgets []storage.Budget, name string) bool {
+	return slices.ContainsFunc(budgets, func(b storage.Budget) bool { return b.Tag != "" && strings.EqualFold(b.Tag, name) })
+}
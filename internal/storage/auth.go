@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// how long a login session stays valid
+const SessionDuration = 30 * 24 * time.Hour
+
+const minPasswordLength = 8
+
+// API token scopes
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+// prefix that makes API tokens recognizable in scripts and secret scanners
+const apiTokenPrefix = "eo_"
+
+var REUsername *regexp.Regexp = regexp.MustCompile(`^[a-z0-9._-]{1,64}$`)
+
+// local account that can sign in to the web UI
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash"`
+	Admin        bool      `json:"admin"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// login session; only a hash of the session token is stored
+type Session struct {
+	ID        string    `json:"id"` // sha256 of the cookie token
+	UserID    string    `json:"userID"`
+	CSRFToken string    `json:"csrfToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// long-lived token for scripted access; only a hash of the token is stored
+type APIToken struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"userID"`
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash"`
+	Scope      string    `json:"scope"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+// normalizes the username and replaces the plain password with its bcrypt hash
+func (u *User) SetCredentials(username, password string) error {
+	u.Username = strings.ToLower(strings.TrimSpace(username))
+	if !REUsername.MatchString(u.Username) {
+		return fmt.Errorf("username must be 1-64 characters of letters, digits, '.', '_' or '-'")
+	}
+	return u.SetPassword(password)
+}
+
+func (u *User) SetPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// creates a session for a user, returning it along with the token to hand to the client
+func NewSession(userID string) (Session, string, error) {
+	token, err := RandomToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+	csrf, err := RandomToken()
+	if err != nil {
+		return Session{}, "", err
+	}
+	return Session{
+		ID:        HashToken(token),
+		UserID:    userID,
+		CSRFToken: csrf,
+		ExpiresAt: time.Now().Add(SessionDuration),
+	}, token, nil
+}
+
+// creates an API token for a user, returning it along with the plain token to hand to the client once
+func NewAPIToken(userID, name, scope string) (APIToken, string, error) {
+	name = SanitizeString(name)
+	if name == "" {
+		return APIToken{}, "", fmt.Errorf("token 'name' cannot be empty")
+	}
+	if scope == "" {
+		scope = ScopeRead
+	}
+	if scope != ScopeRead && scope != ScopeReadWrite {
+		return APIToken{}, "", fmt.Errorf("invalid scope: '%s'. Must be one of 'read' or 'read-write'", scope)
+	}
+	secret, err := RandomToken()
+	if err != nil {
+		return APIToken{}, "", err
+	}
+	token := apiTokenPrefix + secret
+	return APIToken{
+		UserID:    userID,
+		Name:      name,
+		Hash:      HashToken(token),
+		Scope:     scope,
+		CreatedAt: time.Now(),
+	}, token, nil
+}
+
+// returns 32 random bytes encoded for use in cookies and headers
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashes a secret token for storage and lookup
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
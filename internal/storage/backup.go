@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// version of the backup format, raised when older backups need converting on restore
+const BackupVersion = 1
+
+// everything a ledger holds; the config includes its recurring rules, budgets, import profiles
+// and conversions
+type LedgerData struct {
+	Config        Config         `json:"config"`
+	Expenses      []Expense      `json:"expenses"`
+	ExchangeRates []ExchangeRate `json:"exchangeRates"`
+}
+
+// JSON archive of a ledger that restores losslessly to any backend
+type Backup struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	LedgerData
+}
+
+// reads everything the storage's ledger holds into a backup
+func CreateBackup(s Storage) (Backup, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to get config: %v", err)
+	}
+	expenses, err := s.GetAllExpenses()
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to get expenses: %v", err)
+	}
+	rates, err := s.GetExchangeRates("")
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to get exchange rates: %v", err)
+	}
+	backup := Backup{
+		Version:    BackupVersion,
+		CreatedAt:  time.Now().UTC(),
+		LedgerData: LedgerData{Config: *config, Expenses: expenses, ExchangeRates: rates},
+	}
+	backup.normalize()
+	return backup, nil
+}
+
+// replaces nil collections with empty ones so every backend writes and compares them alike
+func (d *LedgerData) normalize() {
+	c := &d.Config
+	if c.Categories == nil {
+		c.Categories = []string{}
+	}
+	if c.RecurringExpenses == nil {
+		c.RecurringExpenses = []RecurringExpense{}
+	}
+	if c.Conversions == nil {
+		c.Conversions = map[string]float64{}
+	}
+	if c.Budgets == nil {
+		c.Budgets = []Budget{}
+	}
+	if c.ImportProfiles == nil {
+		c.ImportProfiles = []ImportProfile{}
+	}
+	if c.CategoryRules == nil {
+		c.CategoryRules = []CategoryRule{}
+	}
+	if c.Tags == nil {
+		c.Tags = []Tag{}
+	}
+	if d.Expenses == nil {
+		d.Expenses = []Expense{}
+	}
+	if d.ExchangeRates == nil {
+		d.ExchangeRates = []ExchangeRate{}
+	}
+}
+
+// checks a backup before it is restored; records keep their IDs, so they must have unique ones
+func (b *Backup) Validate() error {
+	if b.Version < 1 || b.Version > BackupVersion {
+		return fmt.Errorf("unsupported backup version %d, this server reads versions 1 to %d", b.Version, BackupVersion)
+	}
+	b.normalize()
+	c := &b.Config
+	c.Currency = strings.ToLower(strings.TrimSpace(c.Currency))
+	if !slices.Contains(SupportedCurrencies, c.Currency) {
+		return fmt.Errorf("invalid currency: %s", c.Currency)
+	}
+	if c.StartDate < 1 || c.StartDate > 31 {
+		return fmt.Errorf("invalid start date: %d", c.StartDate)
+	}
+	for i := range c.Categories {
+		category, err := ValidateCategory(c.Categories[i])
+		if err != nil {
+			return err
+		}
+		c.Categories[i] = category
+	}
+	conversions, err := ValidateConversions(c.Conversions)
+	if err != nil {
+		return err
+	}
+	c.Conversions = conversions
+	if c.Tags, err = ValidateTags(c.Tags); err != nil {
+		return err
+	}
+	if err := uniqueIDs("recurring expense", c.RecurringExpenses, func(r RecurringExpense) string { return r.ID }); err != nil {
+		return err
+	}
+	for i := range c.RecurringExpenses {
+		if err := c.RecurringExpenses[i].Validate(); err != nil {
+			return fmt.Errorf("recurring expense %s: %v", c.RecurringExpenses[i].ID, err)
+		}
+	}
+	if err := uniqueIDs("budget", c.Budgets, func(b Budget) string { return b.ID }); err != nil {
+		return err
+	}
+	for i := range c.Budgets {
+		if err := c.Budgets[i].Validate(); err != nil {
+			return fmt.Errorf("budget %s: %v", c.Budgets[i].ID, err)
+		}
+		if BudgetConflicts(c.Budgets[:i], c.Budgets[i]) {
+			return fmt.Errorf("duplicate budget for '%s'", c.Budgets[i].Target())
+		}
+	}
+	if err := uniqueIDs("import profile", c.ImportProfiles, func(p ImportProfile) string { return p.ID }); err != nil {
+		return err
+	}
+	for i := range c.ImportProfiles {
+		if err := c.ImportProfiles[i].Validate(); err != nil {
+			return fmt.Errorf("import profile %s: %v", c.ImportProfiles[i].ID, err)
+		}
+		if importProfileConflicts(c.ImportProfiles[:i], c.ImportProfiles[i]) {
+			return fmt.Errorf("duplicate import profile name: %s", c.ImportProfiles[i].Name)
+		}
+	}
+	if err := uniqueIDs("category rule", c.CategoryRules, func(r CategoryRule) string { return r.ID }); err != nil {
+		return err
+	}
+	for i := range c.CategoryRules {
+		if err := c.CategoryRules[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if err := uniqueIDs("expense", b.Expenses, func(e Expense) string { return e.ID }); err != nil {
+		return err
+	}
+	for i := range b.Expenses {
+		if err := b.Expenses[i].Validate(); err != nil {
+			return fmt.Errorf("expense %s: %v", b.Expenses[i].ID, err)
+		}
+	}
+	for i := range b.ExchangeRates {
+		if err := b.ExchangeRates[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uniqueIDs[T any](kind string, items []T, id func(T) string) error {
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		itemID := id(item)
+		if itemID == "" {
+			return fmt.Errorf("%s without an ID", kind)
+		}
+		if seen[itemID] {
+			return fmt.Errorf("duplicate %s ID %s", kind, itemID)
+		}
+		seen[itemID] = true
+	}
+	return nil
+}
+
+// adds the restored data to the current data; where both have a record with the same ID, the same
+// conversion or the same rate, the current one is kept, as are the currency and start date. Restored
+// budgets for a category or tag that already has one are skipped, and so are the restored conversions
+// and rates when they are relative to another currency
+func MergeLedgerData(current, restored LedgerData) LedgerData {
+	current.normalize()
+	merged := current
+	c := &merged.Config
+	c.Categories = slices.Clone(c.Categories)
+	for _, category := range restored.Config.Categories {
+		if !slices.ContainsFunc(c.Categories, func(existing string) bool { return strings.EqualFold(existing, category) }) {
+			c.Categories = append(c.Categories, category)
+		}
+	}
+	c.RecurringExpenses = mergeByID(c.RecurringExpenses, restored.Config.RecurringExpenses, func(r RecurringExpense) string { return r.ID })
+	c.Budgets = slices.Clone(c.Budgets)
+	for _, b := range restored.Config.Budgets {
+		if !slices.ContainsFunc(c.Budgets, func(existing Budget) bool { return existing.ID == b.ID }) && !BudgetConflicts(c.Budgets, b) {
+			c.Budgets = append(c.Budgets, b)
+		}
+	}
+	c.ImportProfiles = slices.Clone(c.ImportProfiles)
+	for _, p := range restored.Config.ImportProfiles {
+		if !slices.ContainsFunc(c.ImportProfiles, func(existing ImportProfile) bool { return existing.ID == p.ID }) && !importProfileConflicts(c.ImportProfiles, p) {
+			c.ImportProfiles = append(c.ImportProfiles, p)
+		}
+	}
+	c.CategoryRules = mergeByID(c.CategoryRules, restored.Config.CategoryRules, func(r CategoryRule) string { return r.ID })
+	c.Tags = slices.Clone(c.Tags)
+	for _, tag := range restored.Config.Tags {
+		if !slices.ContainsFunc(c.Tags, func(existing Tag) bool { return strings.EqualFold(existing.Name, tag.Name) }) {
+			c.Tags = append(c.Tags, tag)
+		}
+	}
+	merged.Expenses = mergeByID(current.Expenses, restored.Expenses, func(e Expense) string { return e.ID })
+	if strings.EqualFold(current.Config.Currency, restored.Config.Currency) {
+		c.Conversions = maps.Clone(restored.Config.Conversions)
+		maps.Copy(c.Conversions, current.Config.Conversions)
+		merged.ExchangeRates = mergeExchangeRates(slices.Clone(restored.ExchangeRates), current.ExchangeRates)
+	}
+	return merged
+}
+
+// appends the restored items whose IDs aren't among the current ones
+func mergeByID[T any](current, restored []T, id func(T) string) []T {
+	merged := slices.Clone(current)
+	seen := make(map[string]bool, len(current))
+	for _, item := range current {
+		seen[id(item)] = true
+	}
+	for _, item := range restored {
+		if !seen[id(item)] {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
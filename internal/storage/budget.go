@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// rollover rules for carrying a budget balance into the next month
+const (
+	RolloverNone     = "none"
+	RolloverPositive = "positive" // only unspent amounts carry over
+	RolloverFull     = "full"     // unspent and overspent amounts carry over
+)
+
+// caps how far back envelope balances are replayed
+const maxRolloverPeriods = 240
+
+// monthly spending limit for a category or a tag, in the base currency
+type Budget struct {
+	ID        string    `json:"id"`
+	Category  string    `json:"category"` // exactly one of category or tag is set
+	Tag       string    `json:"tag"`
+	Limit     float64   `json:"limit"`
+	Rollover  string    `json:"rollover"`
+	StartDate time.Time `json:"startDate"` // first month balances roll over from
+}
+
+// spending against a budget within one start-date aligned month
+type BudgetStatus struct {
+	Budget
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Carryover float64   `json:"carryover"` // balance carried in from the previous month
+	Available float64   `json:"available"` // limit plus carryover
+	Spent     float64   `json:"spent"`
+	Remaining float64   `json:"remaining"`
+	Percent   float64   `json:"percent"`
+	Overspent bool      `json:"overspent"`
+}
+
+func (b *Budget) Validate() error {
+	b.Category = SanitizeString(b.Category)
+	b.Tag = SanitizeString(b.Tag)
+	if (b.Category == "") == (b.Tag == "") {
+		return fmt.Errorf("budget must have exactly one of 'category' or 'tag'")
+	}
+	if b.Limit <= 0 {
+		return fmt.Errorf("budget 'limit' must be greater than 0")
+	}
+	if b.Rollover == "" {
+		b.Rollover = RolloverNone
+	}
+	if !slices.Contains([]string{RolloverNone, RolloverPositive, RolloverFull}, b.Rollover) {
+		return fmt.Errorf("invalid rollover: '%s'. Must be one of 'none', 'positive', or 'full'", b.Rollover)
+	}
+	return nil
+}
+
+// returns the balance carried into the next month given this month's remaining amount
+func (b *Budget) carryover(remaining float64) float64 {
+	switch b.Rollover {
+	case RolloverFull:
+		return remaining
+	case RolloverPositive:
+		return max(remaining, 0)
+	}
+	return 0
+}
+
+// returns the category or tag name the budget tracks
+func (b *Budget) Target() string {
+	if b.Category != "" {
+		return b.Category
+	}
+	return b.Tag
+}
+
+// reports whether another budget already tracks the same category or tag
+func BudgetConflicts(budgets []Budget, budget Budget) bool {
+	for _, b := range budgets {
+		if b.ID == budget.ID {
+			continue
+		}
+		if budget.Category != "" && strings.EqualFold(b.Category, budget.Category) {
+			return true
+		}
+		if budget.Tag != "" && strings.EqualFold(b.Tag, budget.Tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// computes the status of every budget for the start-date aligned month containing ref
+func GetBudgetStatuses(s Storage, ref time.Time) ([]BudgetStatus, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := PeriodBounds(PeriodMonth, ref, config.StartDate)
+	if err != nil {
+		return nil, err
+	}
+	// rollover budgets are replayed from their first month, so expenses are loaded from the earliest one
+	first := from
+	for _, b := range config.Budgets {
+		if b.Rollover == "" || b.Rollover == RolloverNone {
+			continue
+		}
+		months, err := budgetMonths(b, ref, config.StartDate)
+		if err != nil {
+			return nil, err
+		}
+		if months[0].from.Before(first) {
+			first = months[0].from
+		}
+	}
+	expenses, err := loadBudgetExpenses(s, first, to)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]BudgetStatus, 0, len(config.Budgets))
+	for _, b := range config.Budgets {
+		if b.Rollover == "" || b.Rollover == RolloverNone {
+			statuses = append(statuses, newBudgetStatus(b, from, to, expenses.spent(b, from, to), 0))
+			continue
+		}
+		history, err := expenses.history(b, ref, config.StartDate)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, history[len(history)-1])
+	}
+	return statuses, nil
+}
+
+// replays a budget month by month from its start date through the month containing ref,
+// carrying balances forward according to its rollover rule
+func GetBudgetHistory(s Storage, budget Budget, ref time.Time, startDate int) ([]BudgetStatus, error) {
+	months, err := budgetMonths(budget, ref, startDate)
+	if err != nil {
+		return nil, err
+	}
+	expenses, err := loadBudgetExpenses(s, months[0].from, months[len(months)-1].to)
+	if err != nil {
+		return nil, err
+	}
+	return expenses.history(budget, ref, startDate)
+}
+
+type budgetMonth struct{ from, to time.Time }
+
+// the start-date aligned months a budget is replayed over, from its start date but at most
+// maxRolloverPeriods back, through the month containing ref
+func budgetMonths(budget Budget, ref time.Time, startDate int) ([]budgetMonth, error) {
+	current, _, err := PeriodBounds(PeriodMonth, ref, startDate)
+	if err != nil {
+		return nil, err
+	}
+	first := current
+	if budget.Rollover != RolloverNone && !budget.StartDate.IsZero() {
+		first = MonthStart(budget.StartDate.In(ref.Location()), startDate)
+	}
+	if first.After(current) {
+		first = current
+	}
+	if earliest := MonthStart(current.AddDate(0, -maxRolloverPeriods, 0), startDate); first.Before(earliest) {
+		first = earliest
+	}
+	var months []budgetMonth
+	for periodStart := first; !periodStart.After(current); {
+		from, to, err := PeriodBounds(PeriodMonth, periodStart, startDate)
+		if err != nil {
+			return nil, err
+		}
+		months = append(months, budgetMonth{from, to})
+		periodStart = to.Add(time.Nanosecond)
+	}
+	return months, nil
+}
+
+// the expenses of a date range sorted by date, with the converter to the ledger's currency, so that
+// budgets are totaled over many months with one query instead of a summary per month
+type budgetExpenses struct {
+	expenses  []Expense
+	converter *Converter
+}
+
+func loadBudgetExpenses(s Storage, from, to time.Time) (*budgetExpenses, error) {
+	converter, err := LoadConverter(s)
+	if err != nil {
+		return nil, err
+	}
+	query := ExpenseQuery{From: from, To: to, Sort: SortDateAsc, Limit: maxQueryLimit}
+	var expenses []Expense
+	for {
+		page, err := s.QueryExpenses(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query expenses: %v", err)
+		}
+		expenses = append(expenses, page.Expenses...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	return &budgetExpenses{expenses: expenses, converter: converter}, nil
+}
+
+func (be *budgetExpenses) history(budget Budget, ref time.Time, startDate int) ([]BudgetStatus, error) {
+	months, err := budgetMonths(budget, ref, startDate)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]BudgetStatus, 0, len(months))
+	carry := 0.0
+	for _, m := range months {
+		status := newBudgetStatus(budget, m.from, m.to, be.spent(budget, m.from, m.to), carry)
+		history = append(history, status)
+		carry = budget.carryover(status.Remaining)
+	}
+	return history, nil
+}
+
+// returns what was spent against a budget between from and to, counted like the expense totals
+// of a summary: converted, without settlements, and once for every tag matching a tag budget
+func (be *budgetExpenses) spent(b Budget, from, to time.Time) float64 {
+	i, _ := slices.BinarySearchFunc(be.expenses, from, func(e Expense, t time.Time) int { return e.Date.Compare(t) })
+	var spent float64
+	for _, e := range be.expenses[i:] {
+		if e.Date.After(to) {
+			break
+		}
+		if e.Type == TypeSettlement {
+			continue
+		}
+		amount, _ := be.converter.Convert(e.Amount, e.Currency, e.Date)
+		if amount >= 0 {
+			continue
+		}
+		if b.Tag == "" {
+			if strings.EqualFold(e.Category, b.Category) {
+				spent -= amount
+			}
+			continue
+		}
+		for _, tag := range e.Tags {
+			if strings.EqualFold(tag, b.Tag) {
+				spent -= amount
+			}
+		}
+	}
+	return spent
+}
+
+func newBudgetStatus(b Budget, from, to time.Time, spent, carryover float64) BudgetStatus {
+	available := b.Limit + carryover
+	status := BudgetStatus{
+		Budget:    b,
+		From:      from,
+		To:        to,
+		Carryover: carryover,
+		Available: available,
+		Spent:     spent,
+		Remaining: available - spent,
+		Overspent: spent > available,
+	}
+	if available > 0 {
+		status.Percent = spent / available * 100
+	} else if spent > 0 {
+		status.Percent = 100
+	}
+	return status
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+)
+
+// renames a category in the category list, budgets and category rules; renaming it to a category
+// the list already has merges the two, keeping the position of the existing one
+func (c *Config) recategorize(from, to string) {
+	categories := slices.Clone(c.Categories)
+	i := slices.IndexFunc(categories, func(name string) bool { return strings.EqualFold(name, from) })
+	j := slices.IndexFunc(categories, func(name string) bool { return strings.EqualFold(name, to) && !strings.EqualFold(name, from) })
+	switch {
+	case i >= 0 && j >= 0:
+		categories = slices.Delete(categories, i, i+1)
+	case i >= 0:
+		categories[i] = to
+	case j < 0:
+		categories = append(categories, to)
+	}
+	c.Categories = categories
+	c.Budgets = slices.Clone(c.Budgets)
+	for i := range c.Budgets {
+		if c.Budgets[i].Category != "" && strings.EqualFold(c.Budgets[i].Category, from) {
+			c.Budgets[i].Category = to
+		}
+	}
+	c.CategoryRules = slices.Clone(c.CategoryRules)
+	for i := range c.CategoryRules {
+		if c.CategoryRules[i].Category != "" && strings.EqualFold(c.CategoryRules[i].Category, from) {
+			c.CategoryRules[i].Category = to
+		}
+	}
+}
+
+// spellings of the category among the categories, matched case-insensitively, so database rows can
+// be updated by exact match
+func categorySpellings(categories []string, name string) []string {
+	var spellings []string
+	for _, c := range categories {
+		if strings.EqualFold(c, name) && !slices.Contains(spellings, c) {
+			spellings = append(spellings, c)
+		}
+	}
+	return spellings
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// rate of one unit of a currency in the base currency, valid from its date until the next dated rate
+type ExchangeRate struct {
+	Currency string    `json:"currency"`
+	Date     time.Time `json:"date"`
+	Rate     float64   `json:"rate"`
+}
+
+// converts amounts into the base currency, preferring the closest dated rate on or before
+// the expense date and falling back to the static rate table
+type Converter struct {
+	Base    string
+	Rates   map[string]float64 // units of base currency per one unit of the keyed currency
+	History map[string][]ExchangeRate
+}
+
+func NewConverter(base string, rates map[string]float64, history []ExchangeRate) *Converter {
+	if rates == nil {
+		rates = map[string]float64{}
+	}
+	c := &Converter{Base: base, Rates: rates, History: map[string][]ExchangeRate{}}
+	for _, r := range history {
+		c.History[r.Currency] = append(c.History[r.Currency], r)
+	}
+	for _, rates := range c.History {
+		slices.SortFunc(rates, func(a, b ExchangeRate) int { return a.Date.Compare(b.Date) })
+	}
+	return c
+}
+
+// builds a converter from the configured base currency, static rates and rate history
+func LoadConverter(s Storage) (*Converter, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.GetExchangeRates("")
+	if err != nil {
+		return nil, err
+	}
+	return NewConverter(config.Currency, config.Conversions, history), nil
+}
+
+// returns the rate for a currency on a date, which is 1 for the base currency (or an unset currency)
+func (c *Converter) Rate(currency string, date time.Time) (float64, bool) {
+	if currency == "" || currency == c.Base {
+		return 1, true
+	}
+	history := c.History[currency]
+	day := RateDate(date)
+	// index of the first rate dated after the expense day, the one before it is the closest prior rate
+	i, _ := slices.BinarySearchFunc(history, day, func(r ExchangeRate, t time.Time) int {
+		if r.Date.After(t) {
+			return 1
+		}
+		return -1
+	})
+	if i > 0 {
+		return history[i-1].Rate, true
+	}
+	rate, ok := c.Rates[currency]
+	return rate, ok
+}
+
+// converts an amount to the base currency, rounded to cents; unknown currencies are returned unconverted with ok=false
+func (c *Converter) Convert(amount float64, currency string, date time.Time) (float64, bool) {
+	rate, ok := c.Rate(currency, date)
+	if !ok {
+		return amount, false
+	}
+	return math.Round(amount*rate*100) / 100, true
+}
+
+// truncates a time to the UTC day that dated rates are keyed by
+func RateDate(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// normalizes currency codes and checks that every rate is usable
+func ValidateConversions(conversions map[string]float64) (map[string]float64, error) {
+	cleaned := make(map[string]float64, len(conversions))
+	for currency, rate := range conversions {
+		code := strings.ToLower(strings.TrimSpace(currency))
+		if !slices.Contains(SupportedCurrencies, code) {
+			return nil, fmt.Errorf("invalid currency: %s", currency)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("conversion rate for '%s' must be greater than 0", code)
+		}
+		cleaned[code] = rate
+	}
+	return cleaned, nil
+}
+
+func (r *ExchangeRate) Validate() error {
+	r.Currency = strings.ToLower(strings.TrimSpace(r.Currency))
+	if !slices.Contains(SupportedCurrencies, r.Currency) {
+		return fmt.Errorf("invalid currency: %s", r.Currency)
+	}
+	if r.Date.IsZero() {
+		return fmt.Errorf("exchange rate 'date' cannot be empty")
+	}
+	if r.Rate <= 0 {
+		return fmt.Errorf("exchange rate for '%s' must be greater than 0", r.Currency)
+	}
+	r.Date = RateDate(r.Date)
+	return nil
+}
+
+// merges rates into an existing list, replacing entries with the same currency and date
+func mergeExchangeRates(existing, rates []ExchangeRate) []ExchangeRate {
+	type key struct {
+		currency string
+		date     time.Time
+	}
+	index := make(map[key]int, len(existing))
+	for i, r := range existing {
+		index[key{r.Currency, r.Date}] = i
+	}
+	for _, r := range rates {
+		k := key{r.Currency, r.Date}
+		if i, ok := index[k]; ok {
+			existing[i] = r
+			continue
+		}
+		index[k] = len(existing)
+		existing = append(existing, r)
+	}
+	return existing
+}
@@ -5,19 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"slices"
-	"time"
 
-	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
 
-// databaseStore implements the Storage interface for PostgreSQL.
-type databaseStore struct {
-	db       *sql.DB
-	defaults map[string]string // allows reusing defaults without querying for config
-}
-
 // SQL queries as constants for reusability and clarity.
 const (
 	createExpensesTableSQL = `
@@ -52,6 +43,95 @@ const (
 		currency VARCHAR(255) NOT NULL,
 		start_date INTEGER NOT NULL
 	);`
+
+	createConversionsTableSQL = `
+	CREATE TABLE IF NOT EXISTS conversions (
+		ledger_id VARCHAR(36) NOT NULL DEFAULT 'default',
+		currency VARCHAR(3) NOT NULL,
+		rate NUMERIC(20, 10) NOT NULL,
+		PRIMARY KEY (ledger_id, currency)
+	);`
+
+	addConfigBudgetsColumnSQL = `ALTER TABLE config ADD COLUMN IF NOT EXISTS budgets TEXT NOT NULL DEFAULT '[]';`
+
+	addConfigImportProfilesColumnSQL = `ALTER TABLE config ADD COLUMN IF NOT EXISTS import_profiles TEXT NOT NULL DEFAULT '[]';`
+
+	addConfigCategoryRulesColumnSQL = `ALTER TABLE config ADD COLUMN IF NOT EXISTS category_rules TEXT NOT NULL DEFAULT '[]';`
+
+	addConfigTagsColumnSQL = `ALTER TABLE config ADD COLUMN IF NOT EXISTS tags TEXT NOT NULL DEFAULT '[]';`
+
+	createExchangeRatesTableSQL = `
+	CREATE TABLE IF NOT EXISTS exchange_rates (
+		ledger_id VARCHAR(36) NOT NULL DEFAULT 'default',
+		currency VARCHAR(3) NOT NULL,
+		date DATE NOT NULL,
+		rate NUMERIC(20, 10) NOT NULL,
+		PRIMARY KEY (ledger_id, currency, date)
+	);`
+
+	createUsersTableSQL = `
+	CREATE TABLE IF NOT EXISTS users (
+		id VARCHAR(36) PRIMARY KEY,
+		username VARCHAR(64) NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		admin BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMPTZ NOT NULL
+	);`
+
+	createSessionsTableSQL = `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id VARCHAR(64) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		csrf_token VARCHAR(64) NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL
+	);`
+
+	createAPITokensTableSQL = `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id VARCHAR(36) PRIMARY KEY,
+		user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL,
+		hash VARCHAR(64) NOT NULL UNIQUE,
+		scope VARCHAR(16) NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL,
+		last_used_at TIMESTAMPTZ
+	);`
+
+	createLedgersTableSQL = `
+	CREATE TABLE IF NOT EXISTS ledgers (
+		id VARCHAR(36) PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		owner_id VARCHAR(36) NOT NULL DEFAULT '',
+		members TEXT NOT NULL DEFAULT '[]',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	insertDefaultLedgerSQL = `INSERT INTO ledgers (id, name) VALUES ('default', 'Default') ON CONFLICT (id) DO NOTHING;`
+
+	// existing rows belong to the default ledger
+	addLedgerColumnsSQL = `
+	ALTER TABLE expenses ADD COLUMN IF NOT EXISTS ledger_id VARCHAR(36) NOT NULL DEFAULT 'default';
+	ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS ledger_id VARCHAR(36) NOT NULL DEFAULT 'default';
+	CREATE INDEX IF NOT EXISTS idx_expenses_ledger_date ON expenses (ledger_id, date);
+	CREATE INDEX IF NOT EXISTS idx_recurring_expenses_ledger ON recurring_expenses (ledger_id);`
+
+	addExpenseSplitColumnsSQL = `
+	ALTER TABLE expenses ADD COLUMN IF NOT EXISTS type VARCHAR(16) NOT NULL DEFAULT '';
+	ALTER TABLE expenses ADD COLUMN IF NOT EXISTS paid_by VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE expenses ADD COLUMN IF NOT EXISTS split TEXT NOT NULL DEFAULT 'null';`
+
+	// ids only have to be unique within a ledger, so that one ledger's backup can be restored into another
+	scopeIDsByLedgerSQL = `
+	DO $$ BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.key_column_usage WHERE table_name = 'expenses' AND constraint_name = 'expenses_pkey' AND column_name = 'ledger_id') THEN
+			ALTER TABLE expenses DROP CONSTRAINT expenses_pkey;
+			ALTER TABLE expenses ADD PRIMARY KEY (ledger_id, id);
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.key_column_usage WHERE table_name = 'recurring_expenses' AND constraint_name = 'recurring_expenses_pkey' AND column_name = 'ledger_id') THEN
+			ALTER TABLE recurring_expenses DROP CONSTRAINT recurring_expenses_pkey;
+			ALTER TABLE recurring_expenses ADD PRIMARY KEY (ledger_id, id);
+		END IF;
+	END $$;`
 )
 
 func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
@@ -68,7 +148,7 @@ func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
 	if err := createTables(db); err != nil {
 		return nil, fmt.Errorf("failed to create database tables: %v", err)
 	}
-	return &databaseStore{db: db, defaults: map[string]string{}}, nil
+	return newSQLStore(db, postgresDialect, DefaultLedgerID)
 }
 
 func makeDBURL(baseConfig SystemConfig) string {
@@ -76,7 +156,7 @@ func makeDBURL(baseConfig SystemConfig) string {
 }
 
 func createTables(db *sql.DB) error {
-	for _, query := range []string{createExpensesTableSQL, createRecurringExpensesTableSQL, createConfigTableSQL} {
+	for _, query := range []string{createExpensesTableSQL, createRecurringExpensesTableSQL, createConfigTableSQL, addConfigBudgetsColumnSQL, createConversionsTableSQL, createExchangeRatesTableSQL, createUsersTableSQL, createSessionsTableSQL, createAPITokensTableSQL, createLedgersTableSQL, insertDefaultLedgerSQL, addLedgerColumnsSQL, addExpenseSplitColumnsSQL, addConfigImportProfilesColumnSQL, addConfigCategoryRulesColumnSQL, addConfigTagsColumnSQL, scopeIDsByLedgerSQL} {
 		if _, err := db.Exec(query); err != nil {
 			return err
 		}
@@ -84,495 +164,89 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
-func (s *databaseStore) Close() error {
-	return s.db.Close()
-}
-
-func (s *databaseStore) saveConfig(config *Config) error {
-	categoriesJSON, err := json.Marshal(config.Categories)
-	if err != nil {
-		return fmt.Errorf("failed to marshal categories: %v", err)
-	}
-	query := `
-		INSERT INTO config (id, categories, currency, start_date)
-		VALUES ('default', $1, $2, $3)
-		ON CONFLICT (id) DO UPDATE SET
-			categories = EXCLUDED.categories,
-			currency = EXCLUDED.currency,
-			start_date = EXCLUDED.start_date;
-	`
-	_, err = s.db.Exec(query, string(categoriesJSON), config.Currency, config.StartDate)
-	s.defaults["currency"] = config.Currency
-	s.defaults["start_date"] = fmt.Sprintf("%d", config.StartDate)
-	return err
-}
-
-func (s *databaseStore) updateConfig(updater func(c *Config) error) error {
-	config, err := s.GetConfig()
-	if err != nil {
-		return err
-	}
-	if err := updater(config); err != nil {
-		return err
-	}
-	return s.saveConfig(config)
-}
-
-func (s *databaseStore) GetConfig() (*Config, error) {
-	query := `SELECT categories, currency, start_date FROM config WHERE id = 'default'`
-	var categoriesStr, currency string
-	var startDate int
-	err := s.db.QueryRow(query).Scan(&categoriesStr, &currency, &startDate)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			config := &Config{}
-			config.SetBaseConfig()
-			if err := s.saveConfig(config); err != nil {
-				return nil, fmt.Errorf("failed to save initial default config: %v", err)
-			}
-			return config, nil
-		}
-		return nil, fmt.Errorf("failed to get config from db: %v", err)
-	}
-
-	var config Config
-	config.Currency = currency
-	config.StartDate = startDate
-	if err := json.Unmarshal([]byte(categoriesStr), &config.Categories); err != nil {
-		return nil, fmt.Errorf("failed to parse categories from db: %v", err)
-	}
-
-	recurring, err := s.GetRecurringExpenses()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get recurring expenses for config: %v", err)
-	}
-	config.RecurringExpenses = recurring
-
-	return &config, nil
-}
-
-func (s *databaseStore) GetCategories() ([]string, error) {
-	config, err := s.GetConfig()
-	if err != nil {
-		return nil, err
-	}
-	return config.Categories, nil
-}
-
-func (s *databaseStore) UpdateCategories(categories []string) error {
-	return s.updateConfig(func(c *Config) error {
-		c.Categories = categories
-		return nil
-	})
-}
-
-func (s *databaseStore) GetCurrency() (string, error) {
-	config, err := s.GetConfig()
-	if err != nil {
-		return "", err
-	}
-	return config.Currency, nil
-}
-
-func (s *databaseStore) UpdateCurrency(currency string) error {
-	if !slices.Contains(SupportedCurrencies, currency) {
-		return fmt.Errorf("invalid currency: %s", currency)
-	}
-	return s.updateConfig(func(c *Config) error {
-		c.Currency = currency
-		return nil
-	})
-}
-
-func (s *databaseStore) GetStartDate() (int, error) {
-	config, err := s.GetConfig()
-	if err != nil {
-		return 0, err
-	}
-	return config.StartDate, nil
-}
-
-func (s *databaseStore) UpdateStartDate(startDate int) error {
-	if startDate < 1 || startDate > 31 {
-		return fmt.Errorf("invalid start date: %d", startDate)
-	}
-	return s.updateConfig(func(c *Config) error {
-		c.StartDate = startDate
-		return nil
-	})
-}
-
-func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
-	var expense Expense
-	var tagsStr sql.NullString
-	var recurringID sql.NullString
-	err := scanner.Scan(&expense.ID, &recurringID, &expense.Name, &expense.Category, &expense.Amount, &expense.Date, &tagsStr)
-	if err != nil {
-		return Expense{}, err
-	}
-	if recurringID.Valid {
-		expense.RecurringID = recurringID.String
-	}
-	if tagsStr.Valid && tagsStr.String != "" {
-		if err := json.Unmarshal([]byte(tagsStr.String), &expense.Tags); err != nil {
-			return Expense{}, fmt.Errorf("failed to parse tags for expense %s: %v", expense.ID, err)
-		}
-	}
-	return expense, nil
-}
-
-func (s *databaseStore) GetAllExpenses() ([]Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, date, tags FROM expenses ORDER BY date DESC`
-	rows, err := s.db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query expenses: %v", err)
-	}
-	defer rows.Close()
-
-	var expenses []Expense
-	for rows.Next() {
-		expense, err := scanExpense(rows)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan expense: %v", err)
-		}
-		expenses = append(expenses, expense)
-	}
-	return expenses, nil
-}
-
-func (s *databaseStore) GetExpense(id string) (Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, date, tags FROM expenses WHERE id = $1`
-	expense, err := scanExpense(s.db.QueryRow(query, id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return Expense{}, fmt.Errorf("expense with ID %s not found", id)
-		}
-		return Expense{}, fmt.Errorf("failed to get expense: %v", err)
-	}
-	return expense, nil
-}
-
-func (s *databaseStore) AddExpense(expense Expense) error {
-	if expense.ID == "" {
-		expense.ID = uuid.New().String()
-	}
-	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
-	}
-	if expense.Date.IsZero() {
-		expense.Date = time.Now()
-	}
-	tagsJSON, err := json.Marshal(expense.Tags)
-	if err != nil {
-		return err
-	}
-	query := `
-		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`
-	_, err = s.db.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON))
-	return err
-}
-
-func (s *databaseStore) UpdateExpense(id string, expense Expense) error {
-	tagsJSON, err := json.Marshal(expense.Tags)
-	if err != nil {
-		return err
-	}
-	// TODO: revisit to maybe remove this later, might not be a good default for update
-	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
-	}
-	query := `
-		UPDATE expenses
-		SET name = $1, category = $2, amount = $3, currency = $4, date = $5, tags = $6, recurring_id = $7
-		WHERE id = $8
-	`
-	result, err := s.db.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.RecurringID, id)
-	if err != nil {
-		return fmt.Errorf("failed to update expense: %v", err)
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("expense with ID %s not found", id)
-	}
-	return nil
-}
+// tags are stored as a JSON array string (or "null"), this normalizes them to a jsonb array
+const tagsArraySQL = `COALESCE(NULLIF(NULLIF(tags, ''), 'null'), '[]')::jsonb`
 
-func (s *databaseStore) RemoveExpense(id string) error {
-	query := `DELETE FROM expenses WHERE id = $1`
-	result, err := s.db.Exec(query, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete expense: %v", err)
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
-	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("expense with ID %s not found", id)
-	}
-	return nil
-}
+// expenses joined with the closest prior dated rate (h) and the static rate (c); $3 is the base currency
+// and $4 the ledger, which callers filter on with e.ledger_id = $4
+const (
+	convertedExpensesSQL = `expenses e
+		LEFT JOIN conversions c ON c.ledger_id = e.ledger_id AND c.currency = e.currency
+		LEFT JOIN LATERAL (
+			SELECT r.rate FROM exchange_rates r
+			WHERE r.ledger_id = e.ledger_id AND r.currency = e.currency AND r.date <= (e.date AT TIME ZONE 'UTC')::date
+			ORDER BY r.date DESC LIMIT 1
+		) h ON true`
+	convertedAmountSQL = `ROUND(e.amount * CASE WHEN e.currency = $3 OR e.currency = '' THEN 1 ELSE COALESCE(h.rate, c.rate, 1) END, 2)`
+
+	summaryFilterSQL = `e.ledger_id = $4 AND e.type <> 'settlement' AND e.date >= $1 AND e.date <= $2`
+
+	groupColumnsSQL = `
+			SUM(CASE WHEN ` + convertedAmountSQL + ` < 0 THEN -` + convertedAmountSQL + ` ELSE 0 END),
+			SUM(CASE WHEN ` + convertedAmountSQL + ` > 0 THEN ` + convertedAmountSQL + ` ELSE 0 END),
+			COUNT(*)`
+)
 
-func (s *databaseStore) AddMultipleExpenses(expenses []Expense) error {
-	if len(expenses) == 0 {
-		return nil
-	}
-	// use the same addexpense method
+// PostgreSQL reads tags as jsonb, binds id lists as arrays and bulk loads with COPY
+var postgresDialect = sqlDialect{
+	tagFilterSQL:   "EXISTS (SELECT 1 FROM jsonb_array_elements_text(" + tagsArraySQL + ") AS t(tag) WHERE LOWER(t.tag) = LOWER($%d))",
+	nameFilterSQL:  "POSITION(LOWER($%d) IN LOWER(name)) > 0",
+	lockRowSQL:     " FOR UPDATE",
+	idListSQL:      "id = ANY($1)",
+	idListArg:      func(ids []string) (any, error) { return pq.Array(ids), nil },
+	insertExpenses: copyExpenses,
+	summaryTotalsSQL: `
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN ` + convertedAmountSQL + ` > 0 THEN ` + convertedAmountSQL + ` ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN ` + convertedAmountSQL + ` < 0 THEN -` + convertedAmountSQL + ` ELSE 0 END), 0)
+		FROM ` + convertedExpensesSQL + ` WHERE ` + summaryFilterSQL,
+	summaryCategoriesSQL: `
+		SELECT e.category,` + groupColumnsSQL + `
+		FROM ` + convertedExpensesSQL + ` WHERE ` + summaryFilterSQL + `
+		GROUP BY e.category`,
+	summaryTagsSQL: `
+		SELECT t.tag,` + groupColumnsSQL + `
+		FROM ` + convertedExpensesSQL + ` CROSS JOIN LATERAL jsonb_array_elements_text(` + tagsArraySQL + `) AS t(tag)
+		WHERE ` + summaryFilterSQL + `
+		GROUP BY t.tag`,
+	summaryMissingSQL: `
+		SELECT DISTINCT e.currency FROM ` + convertedExpensesSQL + `
+		WHERE ` + summaryFilterSQL + ` AND h.rate IS NULL AND c.rate IS NULL AND e.currency <> $3 AND e.currency <> ''
+		ORDER BY e.currency`,
+	tagCountsSQL: `
+		SELECT tag, SUM(expenses), SUM(recurring) FROM (
+			SELECT t.tag, 1 AS expenses, 0 AS recurring
+			FROM expenses CROSS JOIN LATERAL jsonb_array_elements_text(` + tagsArraySQL + `) AS t(tag) WHERE ledger_id = $1
+			UNION ALL
+			SELECT t.tag, 0, 1
+			FROM recurring_expenses CROSS JOIN LATERAL jsonb_array_elements_text(` + tagsArraySQL + `) AS t(tag) WHERE ledger_id = $1
+		) AS used
+		GROUP BY tag
+		ORDER BY tag`,
+}
+
+// streams the expenses into the table with COPY within the caller's transaction
+func copyExpenses(tx *sql.Tx, ledgerID string, expenses []Expense) error {
+	stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags", "type", "paid_by", "split", "ledger_id"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy in: %v", err)
+	}
+	defer stmt.Close()
 	for _, exp := range expenses {
-		if err := s.AddExpense(exp); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (s *databaseStore) RemoveMultipleExpenses(ids []string) error {
-	if len(ids) == 0 {
-		return nil
-	}
-	query := `DELETE FROM expenses WHERE id = ANY($1)`
-	_, err := s.db.Exec(query, pq.Array(ids))
-	if err != nil {
-		return fmt.Errorf("failed to delete multiple expenses: %v", err)
-	}
-	return nil
-}
-
-func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExpense, error) {
-	var re RecurringExpense
-	var tagsStr sql.NullString
-	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr)
-	if err != nil {
-		return RecurringExpense{}, err
-	}
-	if tagsStr.Valid && tagsStr.String != "" {
-		if err := json.Unmarshal([]byte(tagsStr.String), &re.Tags); err != nil {
-			return RecurringExpense{}, fmt.Errorf("failed to parse tags for recurring expense %s: %v", re.ID, err)
-		}
-	}
-	return re, nil
-}
-
-func (s *databaseStore) GetRecurringExpenses() ([]RecurringExpense, error) {
-	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags FROM recurring_expenses`
-	rows, err := s.db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query recurring expenses: %v", err)
-	}
-	defer rows.Close()
-	var recurringExpenses []RecurringExpense
-	for rows.Next() {
-		re, err := scanRecurringExpense(rows)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan recurring expense: %v", err)
-		}
-		recurringExpenses = append(recurringExpenses, re)
-	}
-	return recurringExpenses, nil
-}
-
-func (s *databaseStore) GetRecurringExpense(id string) (RecurringExpense, error) {
-	query := `SELECT id, name, amount, category, start_date, interval, occurrences, tags FROM recurring_expenses WHERE id = $1`
-	re, err := scanRecurringExpense(s.db.QueryRow(query, id))
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
-		}
-		return RecurringExpense{}, fmt.Errorf("failed to get recurring expense: %v", err)
-	}
-	return re, nil
-}
-
-func (s *databaseStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
-	}
-	defer tx.Rollback() // Rollback on error
-
-	if recurringExpense.ID == "" {
-		recurringExpense.ID = uuid.New().String()
-	}
-	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
-	}
-	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
-	ruleQuery := `
-		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`
-	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON))
-	if err != nil {
-		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
-	}
-
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, false)
-	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
+		tagsJSON, err := json.Marshal(exp.Tags)
 		if err != nil {
-			return fmt.Errorf("failed to prepare copy in: %v", err)
-		}
-		defer stmt.Close()
-		for _, exp := range expensesToAdd {
-			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
-			if err != nil {
-				return fmt.Errorf("failed to execute copy in: %v", err)
-			}
-		}
-		if _, err = stmt.Exec(); err != nil {
-			return fmt.Errorf("failed to finalize copy in: %v", err)
+			return err
 		}
-	}
-	return tx.Commit()
-}
-
-func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
-	}
-	defer tx.Rollback()
-	recurringExpense.ID = id // Ensure ID is preserved
-	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
-	}
-	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
-	ruleQuery := `
-		UPDATE recurring_expenses
-		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, tags = $7, currency = $8
-		WHERE id = $9
-	`
-	res, err := tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, id)
-	if err != nil {
-		return fmt.Errorf("failed to update recurring expense rule: %v", err)
-	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("recurring expense with ID %s not found to update", id)
-	}
-
-	var deleteQuery string
-	if updateAll {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
-	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
-	}
-	if err != nil {
-		return fmt.Errorf("failed to delete old expense instances for update: %v", err)
-	}
-
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, !updateAll)
-	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
+		splitJSON, err := json.Marshal(exp.Split)
 		if err != nil {
-			return fmt.Errorf("failed to prepare copy in for update: %v", err)
-		}
-		defer stmt.Close()
-		for _, exp := range expensesToAdd {
-			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
-			if err != nil {
-				return fmt.Errorf("failed to execute copy in for update: %v", err)
-			}
-		}
-		if _, err = stmt.Exec(); err != nil {
-			return fmt.Errorf("failed to finalize copy in for update: %v", err)
+			return err
 		}
-	}
-	return tx.Commit()
-}
-
-func (s *databaseStore) RemoveRecurringExpense(id string, removeAll bool) error {
-	tx, err := s.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
-	}
-	defer tx.Rollback()
-	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1`, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete recurring expense rule: %v", err)
-	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("recurring expense with ID %s not found", id)
-	}
-
-	var deleteQuery string
-	if removeAll {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
-	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
-	}
-	if err != nil {
-		return fmt.Errorf("failed to delete expense instances: %v", err)
-	}
-	return tx.Commit()
-}
-
-func generateExpensesFromRecurring(recExp RecurringExpense, fromToday bool) []Expense {
-	var expenses []Expense
-	currentDate := recExp.StartDate
-	today := time.Now()
-	occurrencesToGenerate := recExp.Occurrences
-	if fromToday {
-		for currentDate.Before(today) && (recExp.Occurrences == 0 || occurrencesToGenerate > 0) {
-			switch recExp.Interval {
-			case "daily":
-				currentDate = currentDate.AddDate(0, 0, 1)
-			case "weekly":
-				currentDate = currentDate.AddDate(0, 0, 7)
-			case "monthly":
-				currentDate = currentDate.AddDate(0, 1, 0)
-			case "yearly":
-				currentDate = currentDate.AddDate(1, 0, 0)
-			default:
-				return expenses // Stop if interval is invalid
-			}
-			if recExp.Occurrences > 0 {
-				occurrencesToGenerate--
-			}
+		if _, err := stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date.UTC(), string(tagsJSON), exp.Type, exp.PaidBy, string(splitJSON), ledgerID); err != nil {
+			return fmt.Errorf("failed to execute copy in: %v", err)
 		}
 	}
-	limit := occurrencesToGenerate
-	// if recExp.Occurrences == 0 {
-	// 	limit = 2000 // Heuristic for "indefinite"
-	// }
-
-	for range limit {
-		expense := Expense{
-			ID:          uuid.New().String(),
-			RecurringID: recExp.ID,
-			Name:        recExp.Name,
-			Category:    recExp.Category,
-			Amount:      recExp.Amount,
-			Currency:    recExp.Currency,
-			Date:        currentDate,
-			Tags:        recExp.Tags,
-		}
-		expenses = append(expenses, expense)
-		switch recExp.Interval {
-		case "daily":
-			currentDate = currentDate.AddDate(0, 0, 1)
-		case "weekly":
-			currentDate = currentDate.AddDate(0, 0, 7)
-		case "monthly":
-			currentDate = currentDate.AddDate(0, 1, 0)
-		case "yearly":
-			currentDate = currentDate.AddDate(1, 0, 0)
-		default:
-			return expenses
-		}
+	if _, err := stmt.Exec(); err != nil {
+		return fmt.Errorf("failed to finalize copy in: %v", err)
 	}
-	return expenses
+	return nil
 }
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// expenses are likely duplicates when they have the same amount and currency, dates at most
+// duplicateDateWindow apart and names at least duplicateNameSimilarity alike
+const (
+	duplicateDateWindow     = 3 * 24 * time.Hour
+	duplicateNameSimilarity = 0.7
+)
+
+// two expenses that look like the same transaction recorded twice
+type DuplicatePair struct {
+	Expense   Expense `json:"expense"`   // the earlier one
+	Duplicate Expense `json:"duplicate"` // the later one
+	Score     float64 `json:"score"`     // name similarity from 0 to 1
+}
+
+// expenses grouped by amount and currency, to find duplicates of many expenses at once
+type DuplicateIndex struct {
+	byAmount map[duplicateKey][]Expense
+}
+
+type duplicateKey struct {
+	currency string
+	cents    int64
+}
+
+func newDuplicateKey(e Expense) duplicateKey {
+	return duplicateKey{e.Currency, int64(math.Round(e.Amount * 100))}
+}
+
+func NewDuplicateIndex(expenses []Expense) *DuplicateIndex {
+	index := &DuplicateIndex{byAmount: map[duplicateKey][]Expense{}}
+	for _, e := range expenses {
+		if e.Type != TypeSettlement {
+			key := newDuplicateKey(e)
+			index.byAmount[key] = append(index.byAmount[key], e)
+		}
+	}
+	return index
+}
+
+// query for the expenses an expense could duplicate: the same amount to the cent and dates
+// within the duplicate window
+func DuplicateCandidates(e Expense) ExpenseQuery {
+	low, high := e.Amount-0.005, e.Amount+0.005
+	return ExpenseQuery{
+		From:      e.Date.Add(-duplicateDateWindow),
+		To:        e.Date.Add(duplicateDateWindow),
+		MinAmount: &low,
+		MaxAmount: &high,
+		Limit:     maxQueryLimit,
+	}
+}
+
+// returns the indexed expenses the expense likely duplicates, best match first, leaving out the
+// IDs in exclude
+func (x *DuplicateIndex) Find(e Expense, exclude map[string]bool) []DuplicatePair {
+	if e.Type == TypeSettlement {
+		return nil
+	}
+	var pairs []DuplicatePair
+	for _, existing := range x.byAmount[newDuplicateKey(e)] {
+		if exclude[existing.ID] || existing.ID == e.ID {
+			continue
+		}
+		if score, ok := duplicateScore(existing, e); ok {
+			pairs = append(pairs, DuplicatePair{Expense: existing, Duplicate: e, Score: score})
+		}
+	}
+	slices.SortFunc(pairs, func(a, b DuplicatePair) int { return cmp.Compare(b.Score, a.Score) })
+	return pairs
+}
+
+// every pair of likely duplicates among the expenses, most similar first
+func FindDuplicates(expenses []Expense) []DuplicatePair {
+	pairs := []DuplicatePair{}
+	for _, group := range NewDuplicateIndex(expenses).byAmount {
+		slices.SortFunc(group, func(a, b Expense) int { return a.Date.Compare(b.Date) })
+		for i, a := range group {
+			for _, b := range group[i+1:] {
+				if b.Date.Sub(a.Date) > duplicateDateWindow {
+					break
+				}
+				if score, ok := duplicateScore(a, b); ok {
+					pairs = append(pairs, DuplicatePair{Expense: a, Duplicate: b, Score: score})
+				}
+			}
+		}
+	}
+	slices.SortFunc(pairs, func(a, b DuplicatePair) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), b.Duplicate.Date.Compare(a.Duplicate.Date))
+	})
+	return pairs
+}
+
+// compares two expenses of the same amount; instances of one recurring expense are never duplicates
+func duplicateScore(a, b Expense) (float64, bool) {
+	if a.RecurringID != "" && a.RecurringID == b.RecurringID {
+		return 0, false
+	}
+	gap := a.Date.Sub(b.Date)
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap > duplicateDateWindow {
+		return 0, false
+	}
+	score := nameSimilarity(a.Name, b.Name)
+	return score, score >= duplicateNameSimilarity
+}
+
+// Dice coefficient of the names' letter and digit bigrams; a short name inside a longer one, like
+// 'tea' in 'steam', shares too few bigrams to count as the same name
+func nameSimilarity(a, b string) float64 {
+	a, b = normalizeName(a), normalizeName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	bigrams := func(s string) map[string]int {
+		counts := map[string]int{}
+		runes := []rune(s)
+		for i := 0; i+1 < len(runes); i++ {
+			counts[string(runes[i:i+2])]++
+		}
+		return counts
+	}
+	aBigrams, bBigrams := bigrams(a), bigrams(b)
+	total, shared := 0, 0
+	for bigram, n := range aBigrams {
+		shared += min(n, bBigrams[bigram])
+		total += n
+	}
+	for _, n := range bBigrams {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// returns the kept expense with the tags of both
+func MergeExpenses(keep, remove Expense) Expense {
+	for _, tag := range remove.Tags {
+		if !slices.ContainsFunc(keep.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			keep.Tags = append(slices.Clip(keep.Tags), tag)
+		}
+	}
+	return keep
+}
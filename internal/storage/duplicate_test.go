@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b      string
+		duplicate bool
+	}{
+		{"Coffee Shop", "COFFEE SHOP #123", true},
+		{"Coffee", "coffee", true},
+		{"tea", "steam", false},
+		{"Uber", "Uber Eats", false},
+	}
+	for _, tt := range tests {
+		if got := nameSimilarity(tt.a, tt.b) >= duplicateNameSimilarity; got != tt.duplicate {
+			t.Errorf("nameSimilarity(%q, %q) = %v, want duplicate %v", tt.a, tt.b, nameSimilarity(tt.a, tt.b), tt.duplicate)
+		}
+	}
+}
+
+func TestFindDuplicatesIgnoresSubstringNames(t *testing.T) {
+	date := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	expenses := []Expense{
+		{ID: "1", Name: "tea", Amount: -4, Currency: "usd", Date: date},
+		{ID: "2", Name: "steam", Amount: -4, Currency: "usd", Date: date},
+	}
+	if pairs := FindDuplicates(expenses); len(pairs) != 0 {
+		t.Errorf("FindDuplicates() = %v, want no pairs", pairs)
+	}
+}
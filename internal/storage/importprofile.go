@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// saved description of a bank's CSV export, mapping its columns onto expense fields
+type ImportProfile struct {
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Delimiter       string        `json:"delimiter"`  // single character, default ','
+	Decimal         string        `json:"decimal"`    // '.' or ',', the other one is taken as a thousands separator
+	DateFormat      string        `json:"dateFormat"` // e.g. DD/MM/YYYY or a Go layout, empty tries the common formats
+	Columns         ImportColumns `json:"columns"`
+	InvertSign      bool          `json:"invertSign"`      // for exports that list spending as positive amounts
+	DefaultCategory string        `json:"defaultCategory"` // used when there is no category column or it is empty
+}
+
+// header names of the columns holding each field; empty when the file has no such column
+type ImportColumns struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Amount   string `json:"amount"` // signed amount, or use debit and credit for separate money out and money in columns
+	Debit    string `json:"debit"`
+	Credit   string `json:"credit"`
+	Date     string `json:"date"`
+	Currency string `json:"currency"`
+	Tags     string `json:"tags"`
+}
+
+// date format tokens and their Go layout equivalents, longest first
+var dateFormatTokens = strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02", "M", "1", "D", "2")
+
+func (p *ImportProfile) Validate() error {
+	p.Name = SanitizeString(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("import profile 'name' cannot be empty")
+	}
+	if p.Delimiter == "" {
+		p.Delimiter = ","
+	}
+	if r, size := utf8.DecodeRuneInString(p.Delimiter); size != len(p.Delimiter) || r == '"' || r == '\r' || r == '\n' {
+		return fmt.Errorf("import profile 'delimiter' must be a single character other than a quote or newline")
+	}
+	if p.Decimal == "" {
+		p.Decimal = "."
+	}
+	if p.Decimal != "." && p.Decimal != "," {
+		return fmt.Errorf("import profile 'decimal' must be '.' or ','")
+	}
+	if p.Decimal == p.Delimiter {
+		return fmt.Errorf("import profile 'decimal' and 'delimiter' cannot be the same")
+	}
+	p.DateFormat = strings.TrimSpace(p.DateFormat)
+	c := &p.Columns
+	for _, col := range []*string{&c.Name, &c.Category, &c.Amount, &c.Debit, &c.Credit, &c.Date, &c.Currency, &c.Tags} {
+		*col = strings.TrimSpace(*col)
+	}
+	if c.Name == "" || c.Date == "" {
+		return fmt.Errorf("import profile must map the 'name' and 'date' columns")
+	}
+	if (c.Amount == "") == (c.Debit == "" && c.Credit == "") {
+		return fmt.Errorf("import profile must map either an 'amount' column or 'debit' and 'credit' columns")
+	}
+	p.DefaultCategory = SanitizeString(p.DefaultCategory)
+	if c.Category == "" && p.DefaultCategory == "" {
+		return fmt.Errorf("import profile must map a 'category' column or set a default category")
+	}
+	return nil
+}
+
+// rune separating the fields of a row
+func (p *ImportProfile) Comma() rune {
+	r, _ := utf8.DecodeRuneInString(p.Delimiter)
+	return r
+}
+
+// Go time layout for the date format, empty when dates should be detected
+func (p *ImportProfile) DateLayout() string {
+	if p.DateFormat == "" || strings.Contains(p.DateFormat, "2006") {
+		return p.DateFormat
+	}
+	return dateFormatTokens.Replace(p.DateFormat)
+}
+
+// parses an amount written with the profile's decimal separator, ignoring thousands separators and spaces
+func (p *ImportProfile) ParseAmount(value string) (float64, error) {
+	thousands := ","
+	if p.Decimal == "," {
+		thousands = "."
+	}
+	cleaned := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' || r == '\'' {
+			return -1
+		}
+		return r
+	}, value)
+	cleaned = strings.ReplaceAll(cleaned, thousands, "")
+	cleaned = strings.Replace(cleaned, p.Decimal, ".", 1)
+	amount, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount: %s", value)
+	}
+	return amount, nil
+}
+
+// reports whether another profile already uses the same name
+func importProfileConflicts(profiles []ImportProfile, profile ImportProfile) bool {
+	for _, p := range profiles {
+		if p.ID != profile.ID && strings.EqualFold(p.Name, profile.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// redo log at the storage root for operations that touch more than one file
+const journalFileName = "journal.json"
+
+// suffix of the temporary files atomic writes go through; leftovers are removed on startup
+const tempFileSuffix = ".tmp"
+
+// file write prepared as part of an operation
+type fileWrite struct {
+	Path    string          `json:"path"` // relative to the storage root
+	Content json.RawMessage `json:"content"`
+	Perm    fs.FileMode     `json:"perm"`
+}
+
+// every change of a multi-file operation; once the journal is on disk the operation is committed
+// and replaying it is safe any number of times
+type journal struct {
+	Writes  []fileWrite `json:"writes"`
+	Removes []string    `json:"removes"` // directories removed after the writes, relative to the storage root
+}
+
+// marshals data into a pending write of a file below the storage root
+func newFileWrite(rootPath, path string, data any, perm fs.FileMode) (fileWrite, error) {
+	content, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return fileWrite{}, err
+	}
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil {
+		return fileWrite{}, fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+	return fileWrite{Path: rel, Content: content, Perm: perm}, nil
+}
+
+// replaces a file by writing a synced temporary file next to it and renaming it over the original,
+// so readers and crashes only ever see the old or the new content
+func writeFileAtomic(path string, content []byte, perm fs.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*"+tempFileSuffix)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// makes a rename or removal within the directory durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// commits the journal, applies it and clears it; a crash at any point after the journal is
+// written is finished by recoverJournal on the next start
+func commitJournal(rootPath string, j journal) error {
+	content, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %v", err)
+	}
+	journalPath := filepath.Join(rootPath, journalFileName)
+	if err := writeFileAtomic(journalPath, content, 0600); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	if err := applyJournal(rootPath, j); err != nil {
+		return err
+	}
+	if err := os.Remove(journalPath); err != nil {
+		return fmt.Errorf("failed to clear journal: %v", err)
+	}
+	return syncDir(rootPath)
+}
+
+func applyJournal(rootPath string, j journal) error {
+	for _, w := range j.Writes {
+		path := filepath.Join(rootPath, w.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", w.Path, err)
+		}
+		if err := writeFileAtomic(path, w.Content, w.Perm); err != nil {
+			return fmt.Errorf("failed to write %s: %v", w.Path, err)
+		}
+	}
+	for _, dir := range j.Removes {
+		if err := os.RemoveAll(filepath.Join(rootPath, dir)); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// finishes an operation interrupted after its journal was committed and removes temporary files
+// left by interrupted writes
+func recoverJournal(rootPath string) error {
+	journalPath := filepath.Join(rootPath, journalFileName)
+	content, err := os.ReadFile(journalPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read journal: %v", err)
+	}
+	if err == nil {
+		var j journal
+		if err := json.Unmarshal(content, &j); err != nil {
+			return fmt.Errorf("failed to parse journal: %v", err)
+		}
+		if err := applyJournal(rootPath, j); err != nil {
+			return fmt.Errorf("failed to replay journal: %v", err)
+		}
+		if err := os.Remove(journalPath); err != nil {
+			return fmt.Errorf("failed to clear journal: %v", err)
+		}
+		log.Printf("Recovered interrupted operation touching %d files\n", len(j.Writes))
+	}
+	return filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasPrefix(d.Name(), ".") && strings.HasSuffix(d.Name(), tempFileSuffix) {
+			log.Printf("Removing incomplete write %s\n", path)
+			return os.Remove(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parsed JSON files shared by every ledger view of a storage directory; an entry is reused while
+// the file's modification time and size match what the store last read or wrote, so edits made
+// outside the store are picked up on the next call
+type jsonCache struct {
+	mu    sync.Mutex
+	files map[string]*cachedFile
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	data    any
+}
+
+// expenses file with lookups by expense ID and recurring expense ID; shared, so never modified
+type expenseIndex struct {
+	expenses    []Expense
+	byID        map[string]int
+	byRecurring map[string][]int
+}
+
+func newJsonCache() *jsonCache {
+	return &jsonCache{files: map[string]*cachedFile{}}
+}
+
+func newExpenseIndex(expenses []Expense) *expenseIndex {
+	index := &expenseIndex{
+		expenses:    expenses,
+		byID:        make(map[string]int, len(expenses)),
+		byRecurring: map[string][]int{},
+	}
+	for i, e := range expenses {
+		index.byID[e.ID] = i
+		if e.RecurringID != "" {
+			index.byRecurring[e.RecurringID] = append(index.byRecurring[e.RecurringID], i)
+		}
+	}
+	return index
+}
+
+// copy of the expenses without a recurring expense's future instances, or all of them when all is set
+func (x *expenseIndex) withoutInstances(recurringID string, all bool) []Expense {
+	today := time.Now()
+	drop := map[int]bool{}
+	for _, i := range x.byRecurring[recurringID] {
+		if all || x.expenses[i].Date.After(today) {
+			drop[i] = true
+		}
+	}
+	remaining := make([]Expense, 0, len(x.expenses)-len(drop))
+	for i, e := range x.expenses {
+		if !drop[i] {
+			remaining = append(remaining, e)
+		}
+	}
+	return remaining
+}
+
+// returns the cached contents of a file, parsing it again if it changed since it was cached
+func (c *jsonCache) load(path string, parse func([]byte) (any, error)) (any, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.files[path]; ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+		return f.data, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parse(content)
+	if err != nil {
+		return nil, err
+	}
+	c.files[path] = &cachedFile{modTime: info.ModTime(), size: info.Size(), data: data}
+	return data, nil
+}
+
+// records what the store just wrote to a file so the next read doesn't parse it again
+func (c *jsonCache) store(path string, data any) {
+	info, err := os.Stat(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		delete(c.files, path)
+		return
+	}
+	c.files[path] = &cachedFile{modTime: info.ModTime(), size: info.Size(), data: data}
+}
+
+// drops every file cached below a directory
+func (c *jsonCache) forget(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path := range c.files {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			delete(c.files, path)
+		}
+	}
+}
+
+// copies returned to callers, so changes they make before failing to write never reach the cache;
+// nested slices stay shared and have to be replaced rather than modified in place
+
+func (c *Config) clone() *Config {
+	cloned := *c
+	cloned.Categories = slices.Clone(c.Categories)
+	cloned.RecurringExpenses = slices.Clone(c.RecurringExpenses)
+	cloned.Conversions = maps.Clone(c.Conversions)
+	cloned.Budgets = slices.Clone(c.Budgets)
+	cloned.ImportProfiles = slices.Clone(c.ImportProfiles)
+	cloned.CategoryRules = slices.Clone(c.CategoryRules)
+	cloned.Tags = slices.Clone(c.Tags)
+	return &cloned
+}
+
+func (d *ratesFileData) clone() *ratesFileData {
+	return &ratesFileData{Rates: slices.Clone(d.Rates)}
+}
+
+func (d *ledgersFileData) clone() *ledgersFileData {
+	return &ledgersFileData{Ledgers: slices.Clone(d.Ledgers)}
+}
+
+func (d *authFileData) clone() *authFileData {
+	return &authFileData{Users: slices.Clone(d.Users), Sessions: slices.Clone(d.Sessions), Tokens: slices.Clone(d.Tokens)}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,32 +16,105 @@ import (
 
 // JSONStore implementats Storage interface - for JSON file storage
 type jsonStore struct {
-	configPath string
-	filePath   string
-	mu         sync.RWMutex
-	defaults   map[string]string // allows reusing defaults without querying for config
+	rootPath    string
+	ledgerID    string
+	configPath  string // config, expenses and rates files belong to the ledger
+	filePath    string
+	ratesPath   string
+	authPath    string // users and ledger lists are shared by all ledgers
+	ledgersPath string
+	mu          *sync.RWMutex     // shared by every ledger view of the same storage directory
+	cache       *jsonCache        // shared like mu
+	defaults    map[string]string // allows reusing defaults without querying for config
 }
 
 type expensesFileData struct {
 	Expenses []Expense `json:"expenses"`
 }
 
+type ratesFileData struct {
+	Rates []ExchangeRate `json:"rates"`
+}
+
+type authFileData struct {
+	Users    []User     `json:"users"`
+	Sessions []Session  `json:"sessions"`
+	Tokens   []APIToken `json:"tokens"`
+}
+
+type ledgersFileData struct {
+	Ledgers []Ledger `json:"ledgers"`
+}
+
 func InitializeJsonStore(baseConfig SystemConfig) (*jsonStore, error) {
-	configPath := filepath.Join(baseConfig.StorageURL, "config.json")
-	filePath := filepath.Join(baseConfig.StorageURL, "expenses.json")
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+	rootPath := baseConfig.StorageURL
+	authPath := filepath.Join(rootPath, "auth.json")
+	ledgersPath := filepath.Join(rootPath, "ledgers.json")
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %v", err)
 	}
+	// finish or discard whatever a crash interrupted before anything reads the files
+	if err := recoverJournal(rootPath); err != nil {
+		return nil, err
+	}
+	if err := createLedgerFiles(rootPath); err != nil {
+		return nil, err
+	}
+
+	// create users file if it doesn't exist, readable only by the owner since it holds password hashes
+	if _, err := os.Stat(authPath); os.IsNotExist(err) {
+		data, err := json.Marshal(authFileData{Users: []User{}, Sessions: []Session{}, Tokens: []APIToken{}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal initial users: %v", err)
+		}
+		if err := writeFileAtomic(authPath, data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to create users file: %v", err)
+		}
+		log.Println("Created users file")
+	}
+
+	// create ledgers file if it doesn't exist, the default ledger uses the files at the storage root
+	if _, err := os.Stat(ledgersPath); os.IsNotExist(err) {
+		initialLedgers := ledgersFileData{Ledgers: []Ledger{{ID: DefaultLedgerID, Name: "Default", Members: []string{}, CreatedAt: time.Now()}}}
+		data, err := json.Marshal(initialLedgers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal initial ledgers: %v", err)
+		}
+		if err := writeFileAtomic(ledgersPath, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to create ledgers file: %v", err)
+		}
+		log.Println("Created ledgers file")
+	}
+
+	return newLedgerJsonStore(rootPath, DefaultLedgerID, &sync.RWMutex{}, newJsonCache())
+}
+
+// returns the directory holding a ledger's files; the default ledger keeps its files at the storage root
+func ledgerDir(rootPath, ledgerID string) string {
+	if ledgerID == DefaultLedgerID {
+		return rootPath
+	}
+	return filepath.Join(rootPath, "ledgers", ledgerID)
+}
+
+// creates the expenses, config and exchange rates files of a ledger if they don't exist
+func createLedgerFiles(dir string) error {
+	configPath := filepath.Join(dir, "config.json")
+	filePath := filepath.Join(dir, "expenses.json")
+	ratesPath := filepath.Join(dir, "rates.json")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
 
 	// create expenses file if it doesn't exist
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		initialData := expensesFileData{Expenses: []Expense{}}
 		data, err := json.Marshal(initialData)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal initial data: %v", err)
+			return fmt.Errorf("failed to marshal initial data: %v", err)
 		}
-		if err := os.WriteFile(filePath, data, 0644); err != nil {
-			return nil, fmt.Errorf("failed to create storage file: %v", err)
+		if err := writeFileAtomic(filePath, data, 0644); err != nil {
+			return fmt.Errorf("failed to create storage file: %v", err)
 		}
 		log.Println("Created expense storage file")
 	} else {
@@ -53,36 +127,77 @@ func InitializeJsonStore(baseConfig SystemConfig) (*jsonStore, error) {
 		initialConfig.SetBaseConfig()
 		data, err := json.Marshal(initialConfig)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal initial config: %v", err)
+			return fmt.Errorf("failed to marshal initial config: %v", err)
 		}
-		if err := os.WriteFile(configPath, data, 0644); err != nil {
-			return nil, fmt.Errorf("failed to create config file: %v", err)
+		if err := writeFileAtomic(configPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to create config file: %v", err)
 		}
 		log.Println("Created expense storage config")
 	} else {
 		log.Println("Found existing expense storage config")
 	}
 
-	return &jsonStore{
-		configPath: configPath,
-		filePath:   filePath,
-		defaults:   map[string]string{},
-	}, nil
+	// create exchange rates file if it doesn't exist
+	if _, err := os.Stat(ratesPath); os.IsNotExist(err) {
+		data, err := json.Marshal(ratesFileData{Rates: []ExchangeRate{}})
+		if err != nil {
+			return fmt.Errorf("failed to marshal initial rates: %v", err)
+		}
+		if err := writeFileAtomic(ratesPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to create rates file: %v", err)
+		}
+		log.Println("Created exchange rates file")
+	}
+	return nil
+}
+
+func newLedgerJsonStore(rootPath, ledgerID string, mu *sync.RWMutex, cache *jsonCache) (*jsonStore, error) {
+	dir := ledgerDir(rootPath, ledgerID)
+	store := &jsonStore{
+		rootPath:    rootPath,
+		ledgerID:    ledgerID,
+		configPath:  filepath.Join(dir, "config.json"),
+		filePath:    filepath.Join(dir, "expenses.json"),
+		ratesPath:   filepath.Join(dir, "rates.json"),
+		authPath:    filepath.Join(rootPath, "auth.json"),
+		ledgersPath: filepath.Join(rootPath, "ledgers.json"),
+		mu:          mu,
+		cache:       cache,
+		defaults:    map[string]string{},
+	}
+	config, err := store.readConfigFile(store.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	store.defaults["currency"] = config.Currency
+	store.defaults["start_date"] = fmt.Sprintf("%d", config.StartDate)
+	return store, nil
 }
 
-// primitive methods
+// primitive methods, reading through and writing through the cache
 
-func (s *jsonStore) readExpensesFile(path string) (*expensesFileData, error) {
-	content, err := os.ReadFile(path)
+// cached expenses of the ledger for read-only use; readExpensesFile returns a copy to modify
+func (s *jsonStore) loadExpenses(path string) (*expenseIndex, error) {
+	data, err := s.cache.load(path, func(content []byte) (any, error) {
+		var data expensesFileData
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		log.Println("Read expenses file")
+		return newExpenseIndex(data.Expenses), nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	var data expensesFileData
-	if err := json.Unmarshal(content, &data); err != nil {
+	return data.(*expenseIndex), nil
+}
+
+func (s *jsonStore) readExpensesFile(path string) (*expensesFileData, error) {
+	index, err := s.loadExpenses(path)
+	if err != nil {
 		return nil, err
 	}
-	log.Println("Read expenses file")
-	return &data, nil
+	return &expensesFileData{Expenses: slices.Clone(index.expenses)}, nil
 }
 
 func (s *jsonStore) writeExpensesFile(path string, data *expensesFileData) error {
@@ -90,21 +205,27 @@ func (s *jsonStore) writeExpensesFile(path string, data *expensesFileData) error
 	if err != nil {
 		return err
 	}
+	if err := writeFileAtomic(path, content, 0644); err != nil {
+		return err
+	}
+	s.cache.store(path, newExpenseIndex(data.Expenses))
 	log.Println("Wrote expenses file")
-	return os.WriteFile(path, content, 0644)
+	return nil
 }
 
 func (s *jsonStore) readConfigFile(path string) (*Config, error) {
-	content, err := os.ReadFile(path)
+	data, err := s.cache.load(path, func(content []byte) (any, error) {
+		var data Config
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		log.Println("Read config file")
+		return &data, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	var data Config
-	if err := json.Unmarshal(content, &data); err != nil {
-		return nil, err
-	}
-	log.Println("Read config file")
-	return &data, nil
+	return data.(*Config).clone(), nil
 }
 
 func (s *jsonStore) writeConfigFile(path string, data *Config) error {
@@ -112,8 +233,135 @@ func (s *jsonStore) writeConfigFile(path string, data *Config) error {
 	if err != nil {
 		return err
 	}
+	if err := writeFileAtomic(path, content, 0644); err != nil {
+		return err
+	}
+	s.cache.store(path, data.clone())
 	log.Println("Wrote config file")
-	return os.WriteFile(path, content, 0644)
+	return nil
+}
+
+func (s *jsonStore) readRatesFile(path string) (*ratesFileData, error) {
+	data, err := s.cache.load(path, func(content []byte) (any, error) {
+		var data ratesFileData
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		log.Println("Read exchange rates file")
+		return &data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.(*ratesFileData).clone(), nil
+}
+
+func (s *jsonStore) writeRatesFile(path string, data *ratesFileData) error {
+	content, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, content, 0644); err != nil {
+		return err
+	}
+	s.cache.store(path, data.clone())
+	log.Println("Wrote exchange rates file")
+	return nil
+}
+
+func (s *jsonStore) readLedgersFile(path string) (*ledgersFileData, error) {
+	data, err := s.cache.load(path, func(content []byte) (any, error) {
+		var data ledgersFileData
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		return &data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.(*ledgersFileData).clone(), nil
+}
+
+func (s *jsonStore) writeLedgersFile(path string, data *ledgersFileData) error {
+	content, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, content, 0644); err != nil {
+		return err
+	}
+	s.cache.store(path, data.clone())
+	return nil
+}
+
+func (s *jsonStore) readAuthFile(path string) (*authFileData, error) {
+	data, err := s.cache.load(path, func(content []byte) (any, error) {
+		var data authFileData
+		if err := json.Unmarshal(content, &data); err != nil {
+			return nil, err
+		}
+		return &data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.(*authFileData).clone(), nil
+}
+
+func (s *jsonStore) writeAuthFile(path string, data *authFileData) error {
+	content, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, content, 0600); err != nil {
+		return err
+	}
+	s.cache.store(path, data.clone())
+	return nil
+}
+
+// writes the expenses and config files of the ledger as one journaled operation so a crash
+// cannot leave recurring rules out of step with their generated expenses
+func (s *jsonStore) writeExpensesAndConfig(expenses *expensesFileData, config *Config) error {
+	expensesWrite, err := newFileWrite(s.rootPath, s.filePath, expenses, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage file: %v", err)
+	}
+	configWrite, err := newFileWrite(s.rootPath, s.configPath, config, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config file: %v", err)
+	}
+	if err := commitJournal(s.rootPath, journal{Writes: []fileWrite{expensesWrite, configWrite}}); err != nil {
+		return err
+	}
+	s.cache.store(s.filePath, newExpenseIndex(expenses.Expenses))
+	s.cache.store(s.configPath, config.clone())
+	log.Println("Wrote expenses and config files")
+	return nil
+}
+
+// writes the expenses, config and rates files of the ledger as one journaled operation
+func (s *jsonStore) writeLedgerFiles(expenses *expensesFileData, config *Config, rates *ratesFileData) error {
+	var writes []fileWrite
+	for _, f := range []struct {
+		path string
+		data any
+	}{{s.filePath, expenses}, {s.configPath, config}, {s.ratesPath, rates}} {
+		write, err := newFileWrite(s.rootPath, f.path, f.data, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %v", filepath.Base(f.path), err)
+		}
+		writes = append(writes, write)
+	}
+	if err := commitJournal(s.rootPath, journal{Writes: writes}); err != nil {
+		return err
+	}
+	s.cache.store(s.filePath, newExpenseIndex(expenses.Expenses))
+	s.cache.store(s.configPath, config.clone())
+	s.cache.store(s.ratesPath, rates.clone())
+	log.Println("Wrote expenses, config and exchange rates files")
+	return nil
 }
 
 // ------------------------------------------------------------
@@ -151,6 +399,37 @@ func (s *jsonStore) UpdateCategories(categories []string) error {
 	return s.writeConfigFile(s.configPath, data)
 }
 
+// renames the category on every expense and recurring expense using it, merging it into to if the
+// ledger already has that category
+func (s *jsonStore) RenameCategory(from, to string) error {
+	to, err := ValidateCategory(to)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	expensesData, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
+	}
+	for i := range expensesData.Expenses {
+		if strings.EqualFold(expensesData.Expenses[i].Category, from) {
+			expensesData.Expenses[i].Category = to
+		}
+	}
+	for i := range config.RecurringExpenses {
+		if strings.EqualFold(config.RecurringExpenses[i].Category, from) {
+			config.RecurringExpenses[i].Category = to
+		}
+	}
+	config.recategorize(from, to)
+	return s.writeExpensesAndConfig(expensesData, config)
+}
+
 func (s *jsonStore) GetCurrency() (string, error) {
 	config, err := s.GetConfig()
 	if err != nil {
@@ -232,11 +511,14 @@ func (s *jsonStore) AddRecurringExpense(recurringExpense RecurringExpense) error
 		recurringExpense.Currency = s.defaults["currency"]
 	}
 	config.RecurringExpenses = append(config.RecurringExpenses, recurringExpense)
-	if err := s.writeConfigFile(s.configPath, config); err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
+	expensesData, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
 	}
 	expensesToAdd := generateExpensesFromRecurring(recurringExpense, false)
-	return s.AddMultipleExpenses(expensesToAdd)
+	expensesData.Expenses = append(expensesData.Expenses, expensesToAdd...)
+	log.Printf("Added %d new recurring expense instances\n", len(expensesToAdd))
+	return s.writeExpensesAndConfig(expensesData, config)
 }
 
 func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
@@ -259,26 +541,12 @@ func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
 		return fmt.Errorf("recurring expense with ID %s not found", id)
 	}
 	config.RecurringExpenses = updatedRecurringExpenses
-	expensesData, err := s.readExpensesFile(s.filePath)
+	index, err := s.loadExpenses(s.filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	var updatedExpenses []Expense
-	today := time.Now()
-	for _, exp := range expensesData.Expenses {
-		if exp.RecurringID != id {
-			updatedExpenses = append(updatedExpenses, exp)
-			continue
-		}
-		if !removeAll && !exp.Date.After(today) {
-			updatedExpenses = append(updatedExpenses, exp)
-		}
-	}
-	expensesData.Expenses = updatedExpenses
-	if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
-		return err
-	}
-	return s.writeConfigFile(s.configPath, config)
+	expensesData := &expensesFileData{Expenses: index.withoutInstances(id, removeAll)}
+	return s.writeExpensesAndConfig(expensesData, config)
 }
 
 func (s *jsonStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
@@ -303,28 +571,14 @@ func (s *jsonStore) UpdateRecurringExpense(id string, recurringExpense Recurring
 	if !found {
 		return fmt.Errorf("recurring expense with ID %s not found", id)
 	}
-	expensesData, err := s.readExpensesFile(s.filePath)
+	index, err := s.loadExpenses(s.filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	var remainingExpenses []Expense
-	today := time.Now()
-	for _, exp := range expensesData.Expenses {
-		if exp.RecurringID != id {
-			remainingExpenses = append(remainingExpenses, exp)
-			continue
-		}
-		if !updateAll && !exp.Date.After(today) {
-			remainingExpenses = append(remainingExpenses, exp)
-		}
-	}
-	expensesData.Expenses = remainingExpenses
+	expensesData := &expensesFileData{Expenses: index.withoutInstances(id, updateAll)}
 	expensesToAdd := generateExpensesFromRecurring(recurringExpense, !updateAll)
 	expensesData.Expenses = append(expensesData.Expenses, expensesToAdd...)
-	if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
-		return err
-	}
-	return s.writeConfigFile(s.configPath, config)
+	return s.writeExpensesAndConfig(expensesData, config)
 }
 
 // Expenses
@@ -339,18 +593,26 @@ func (s *jsonStore) GetAllExpenses() ([]Expense, error) {
 	return data.Expenses, nil
 }
 
+func (s *jsonStore) QueryExpenses(query ExpenseQuery) (ExpensePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index, err := s.loadExpenses(s.filePath)
+	if err != nil {
+		return ExpensePage{}, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	return queryExpenseSlice(index.expenses, query)
+}
+
 func (s *jsonStore) GetExpense(id string) (Expense, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	data, err := s.readExpensesFile(s.filePath)
+	index, err := s.loadExpenses(s.filePath)
 	if err != nil {
 		return Expense{}, fmt.Errorf("failed to read storage file: %v", err)
 	}
-	for i, exp := range data.Expenses {
-		if exp.ID == id {
-			log.Printf("Retrieved expense with ID %s\n", id)
-			return data.Expenses[i], nil
-		}
+	if i, ok := index.byID[id]; ok {
+		log.Printf("Retrieved expense with ID %s\n", id)
+		return index.expenses[i], nil
 	}
 	return Expense{}, fmt.Errorf("expense with ID %s not found", id)
 }
@@ -379,38 +641,44 @@ func (s *jsonStore) AddExpense(expense Expense) error {
 func (s *jsonStore) RemoveExpense(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.readExpensesFile(s.filePath)
+	index, err := s.loadExpenses(s.filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	found := false
-	newExpenses := make([]Expense, 0, len(data.Expenses)-1)
-	for _, exp := range data.Expenses {
-		if exp.ID != id {
-			newExpenses = append(newExpenses, exp)
-		} else {
-			found = true
-		}
-	}
+	i, found := index.byID[id]
 	if !found {
 		log.Printf("Expense with ID %s not found\n", id)
 		return fmt.Errorf("expense with ID %s not found", id)
 	}
 	log.Printf("Deleted expense with ID %s\n", id)
-	data.Expenses = newExpenses
-	return s.writeExpensesFile(s.filePath, data)
+	expenses := slices.Delete(slices.Clone(index.expenses), i, i+1)
+	return s.writeExpensesFile(s.filePath, &expensesFileData{Expenses: expenses})
 }
 
+// appends the expenses with a single write of the expenses file
 func (s *jsonStore) AddMultipleExpenses(expensesToAdd []Expense) error {
 	if len(expensesToAdd) == 0 {
 		return nil
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	data, err := s.readExpensesFile(s.filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	data.Expenses = append(data.Expenses, expensesToAdd...)
-	log.Printf("Added %d new recurring expense instances\n", len(expensesToAdd))
+	for _, expense := range expensesToAdd {
+		if expense.ID == "" {
+			expense.ID = uuid.New().String()
+		}
+		if expense.Currency == "" {
+			expense.Currency = s.defaults["currency"]
+		}
+		if expense.Date.IsZero() {
+			expense.Date = time.Now()
+		}
+		data.Expenses = append(data.Expenses, expense)
+	}
+	log.Printf("Added %d expenses\n", len(expensesToAdd))
 	return s.writeExpensesFile(s.filePath, data)
 }
 
@@ -447,26 +715,813 @@ func (s *jsonStore) RemoveMultipleExpenses(ids []string) error {
 func (s *jsonStore) UpdateExpense(id string, expense Expense) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.readExpensesFile(s.filePath)
+	index, err := s.loadExpenses(s.filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	found := false
-	for i, exp := range data.Expenses {
-		if exp.ID == id {
-			data.Expenses[i] = expense
-			data.Expenses[i].ID = id
-			if data.Expenses[i].Currency == "" {
-				data.Expenses[i].Currency = s.defaults["currency"]
-			}
-			found = true
-			break
-		}
-	}
+	i, found := index.byID[id]
 	if !found {
 		log.Printf("expense with ID %s not found\n", id)
 		return fmt.Errorf("expense with ID %s not found", id)
 	}
+	expense.ID = id
+	if expense.Currency == "" {
+		expense.Currency = s.defaults["currency"]
+	}
+	expenses := slices.Clone(index.expenses)
+	expenses[i] = expense
 	log.Printf("Edited expense with ID %s\n", id)
-	return s.writeExpensesFile(s.filePath, data)
+	return s.writeExpensesFile(s.filePath, &expensesFileData{Expenses: expenses})
+}
+
+func (s *jsonStore) UpdateExpenses(expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.loadExpenses(s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
+	}
+	updated := slices.Clone(index.expenses)
+	for _, expense := range expenses {
+		i, found := index.byID[expense.ID]
+		if !found {
+			return fmt.Errorf("expense with ID %s not found", expense.ID)
+		}
+		if expense.Currency == "" {
+			expense.Currency = s.defaults["currency"]
+		}
+		updated[i] = expense
+	}
+	log.Printf("Edited %d expenses\n", len(expenses))
+	return s.writeExpensesFile(s.filePath, &expensesFileData{Expenses: updated})
+}
+
+func (s *jsonStore) MergeExpenses(keep Expense, removeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index, err := s.loadExpenses(s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
+	}
+	k, found := index.byID[keep.ID]
+	if !found {
+		return fmt.Errorf("expense with ID %s not found", keep.ID)
+	}
+	r, found := index.byID[removeID]
+	if !found {
+		return fmt.Errorf("expense with ID %s not found", removeID)
+	}
+	if keep.Currency == "" {
+		keep.Currency = s.defaults["currency"]
+	}
+	expenses := slices.Clone(index.expenses)
+	expenses[k] = keep
+	expenses = slices.Delete(expenses, r, r+1)
+	log.Printf("Merged expense with ID %s into %s\n", removeID, keep.ID)
+	return s.writeExpensesFile(s.filePath, &expensesFileData{Expenses: expenses})
+}
+
+// Reports
+
+func (s *jsonStore) GetSummary(from, to time.Time) (Summary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read config file: %v", err)
+	}
+	index, err := s.loadExpenses(s.filePath)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	rates, err := s.readRatesFile(s.ratesPath)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read rates file: %v", err)
+	}
+	return summarizeExpenses(index.expenses, from, to, NewConverter(config.Currency, config.Conversions, rates.Rates)), nil
+}
+
+// Budgets
+
+func (s *jsonStore) GetBudgets() ([]Budget, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.Budgets == nil {
+		return []Budget{}, nil
+	}
+	return config.Budgets, nil
+}
+
+func (s *jsonStore) AddBudget(budget Budget) (Budget, error) {
+	if err := budget.Validate(); err != nil {
+		return Budget{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return Budget{}, fmt.Errorf("failed to read config file: %v", err)
+	}
+	budget.ID = uuid.New().String()
+	if budget.StartDate.IsZero() {
+		budget.StartDate = time.Now()
+	}
+	if BudgetConflicts(config.Budgets, budget) {
+		return Budget{}, fmt.Errorf("a budget for '%s' already exists", budget.Target())
+	}
+	config.Budgets = append(config.Budgets, budget)
+	return budget, s.writeConfigFile(s.configPath, config)
+}
+
+func (s *jsonStore) UpdateBudget(id string, budget Budget) error {
+	if err := budget.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	budget.ID = id
+	if BudgetConflicts(config.Budgets, budget) {
+		return fmt.Errorf("a budget for '%s' already exists", budget.Target())
+	}
+	for i, b := range config.Budgets {
+		if b.ID == id {
+			if budget.StartDate.IsZero() {
+				budget.StartDate = b.StartDate
+			}
+			config.Budgets[i] = budget
+			return s.writeConfigFile(s.configPath, config)
+		}
+	}
+	return fmt.Errorf("budget with ID %s not found", id)
+}
+
+func (s *jsonStore) RemoveBudget(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	for i, b := range config.Budgets {
+		if b.ID == id {
+			config.Budgets = slices.Delete(config.Budgets, i, i+1)
+			return s.writeConfigFile(s.configPath, config)
+		}
+	}
+	return fmt.Errorf("budget with ID %s not found", id)
+}
+
+// Import Profiles
+
+func (s *jsonStore) GetImportProfiles() ([]ImportProfile, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.ImportProfiles == nil {
+		return []ImportProfile{}, nil
+	}
+	return config.ImportProfiles, nil
+}
+
+func (s *jsonStore) AddImportProfile(profile ImportProfile) (ImportProfile, error) {
+	if err := profile.Validate(); err != nil {
+		return ImportProfile{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return ImportProfile{}, fmt.Errorf("failed to read config file: %v", err)
+	}
+	profile.ID = uuid.New().String()
+	if importProfileConflicts(config.ImportProfiles, profile) {
+		return ImportProfile{}, fmt.Errorf("an import profile named '%s' already exists", profile.Name)
+	}
+	config.ImportProfiles = append(config.ImportProfiles, profile)
+	return profile, s.writeConfigFile(s.configPath, config)
+}
+
+func (s *jsonStore) UpdateImportProfile(id string, profile ImportProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	profile.ID = id
+	if importProfileConflicts(config.ImportProfiles, profile) {
+		return fmt.Errorf("an import profile named '%s' already exists", profile.Name)
+	}
+	for i, p := range config.ImportProfiles {
+		if p.ID == id {
+			config.ImportProfiles[i] = profile
+			return s.writeConfigFile(s.configPath, config)
+		}
+	}
+	return fmt.Errorf("import profile with ID %s not found", id)
+}
+
+func (s *jsonStore) RemoveImportProfile(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	for i, p := range config.ImportProfiles {
+		if p.ID == id {
+			config.ImportProfiles = slices.Delete(config.ImportProfiles, i, i+1)
+			return s.writeConfigFile(s.configPath, config)
+		}
+	}
+	return fmt.Errorf("import profile with ID %s not found", id)
+}
+
+// Category Rules
+
+func (s *jsonStore) GetCategoryRules() ([]CategoryRule, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.CategoryRules == nil {
+		return []CategoryRule{}, nil
+	}
+	return config.CategoryRules, nil
+}
+
+func (s *jsonStore) AddCategoryRule(rule CategoryRule) (CategoryRule, error) {
+	if err := rule.Validate(); err != nil {
+		return CategoryRule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return CategoryRule{}, fmt.Errorf("failed to read config file: %v", err)
+	}
+	rule.ID = uuid.New().String()
+	config.CategoryRules = append(config.CategoryRules, rule)
+	return rule, s.writeConfigFile(s.configPath, config)
+}
+
+func (s *jsonStore) UpdateCategoryRule(id string, rule CategoryRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	rule.ID = id
+	for i, r := range config.CategoryRules {
+		if r.ID == id {
+			config.CategoryRules[i] = rule
+			return s.writeConfigFile(s.configPath, config)
+		}
+	}
+	return fmt.Errorf("category rule with ID %s not found", id)
+}
+
+func (s *jsonStore) RemoveCategoryRule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	for i, r := range config.CategoryRules {
+		if r.ID == id {
+			config.CategoryRules = slices.Delete(config.CategoryRules, i, i+1)
+			return s.writeConfigFile(s.configPath, config)
+		}
+	}
+	return fmt.Errorf("category rule with ID %s not found", id)
+}
+
+// Tags
+
+func (s *jsonStore) GetTags() ([]Tag, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.Tags == nil {
+		return []Tag{}, nil
+	}
+	return config.Tags, nil
+}
+
+func (s *jsonStore) GetTagCounts() ([]TagCount, error) {
+	expenses, err := s.GetAllExpenses()
+	if err != nil {
+		return nil, err
+	}
+	recurring, err := s.GetRecurringExpenses()
+	if err != nil {
+		return nil, err
+	}
+	return countTags(expenses, recurring), nil
+}
+
+func (s *jsonStore) UpdateTags(tags []Tag) error {
+	tags, err := ValidateTags(tags)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	config.Tags = tags
+	return s.writeConfigFile(s.configPath, config)
+}
+
+func (s *jsonStore) RenameTag(from, to string) error {
+	if to = SanitizeString(to); to == "" {
+		return fmt.Errorf("tag name cannot be empty")
+	}
+	return s.retag(from, to)
+}
+
+func (s *jsonStore) RemoveTag(name string) error {
+	return s.retag(name, "")
+}
+
+func (s *jsonStore) retag(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	expensesData, err := s.readExpensesFile(s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
+	}
+	for i := range expensesData.Expenses {
+		expensesData.Expenses[i].Tags, _ = retag(expensesData.Expenses[i].Tags, from, to)
+	}
+	for i := range config.RecurringExpenses {
+		config.RecurringExpenses[i].Tags, _ = retag(config.RecurringExpenses[i].Tags, from, to)
+	}
+	config.retag(from, to)
+	return s.writeExpensesAndConfig(expensesData, config)
+}
+
+// Multi-currency
+
+func (s *jsonStore) GetConversions() (map[string]float64, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.Conversions == nil {
+		return map[string]float64{}, nil
+	}
+	return config.Conversions, nil
+}
+
+func (s *jsonStore) UpdateConversions(conversions map[string]float64) error {
+	conversions, err := ValidateConversions(conversions)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readConfigFile(s.configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	data.Conversions = conversions
+	return s.writeConfigFile(s.configPath, data)
+}
+
+func (s *jsonStore) GetExchangeRates(currency string) ([]ExchangeRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readRatesFile(s.ratesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %v", err)
+	}
+	rates := []ExchangeRate{}
+	for _, r := range data.Rates {
+		if currency == "" || r.Currency == currency {
+			rates = append(rates, r)
+		}
+	}
+	slices.SortFunc(rates, func(a, b ExchangeRate) int {
+		if c := strings.Compare(a.Currency, b.Currency); c != 0 {
+			return c
+		}
+		return a.Date.Compare(b.Date)
+	})
+	return rates, nil
+}
+
+func (s *jsonStore) AddExchangeRates(rates []ExchangeRate) error {
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readRatesFile(s.ratesPath)
+	if err != nil {
+		return fmt.Errorf("failed to read rates file: %v", err)
+	}
+	data.Rates = mergeExchangeRates(data.Rates, rates)
+	log.Printf("Added %d exchange rates\n", len(rates))
+	return s.writeRatesFile(s.ratesPath, data)
+}
+
+func (s *jsonStore) RemoveExchangeRate(currency string, date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readRatesFile(s.ratesPath)
+	if err != nil {
+		return fmt.Errorf("failed to read rates file: %v", err)
+	}
+	date = RateDate(date)
+	remaining := make([]ExchangeRate, 0, len(data.Rates))
+	for _, r := range data.Rates {
+		if r.Currency != currency || !r.Date.Equal(date) {
+			remaining = append(remaining, r)
+		}
+	}
+	if len(remaining) == len(data.Rates) {
+		return fmt.Errorf("exchange rate for %s on %s not found", currency, date.Format("2006-01-02"))
+	}
+	data.Rates = remaining
+	return s.writeRatesFile(s.ratesPath, data)
+}
+
+// Ledgers
+
+func (s *jsonStore) WithLedger(id string) (Storage, error) {
+	if id == "" {
+		id = DefaultLedgerID
+	}
+	if _, err := s.GetLedger(id); err != nil {
+		return nil, err
+	}
+	return newLedgerJsonStore(s.rootPath, id, s.mu, s.cache)
+}
+
+func (s *jsonStore) GetLedgers() ([]Ledger, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readLedgersFile(s.ledgersPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledgers file: %v", err)
+	}
+	return data.Ledgers, nil
+}
+
+func (s *jsonStore) GetLedger(id string) (Ledger, error) {
+	ledgers, err := s.GetLedgers()
+	if err != nil {
+		return Ledger{}, err
+	}
+	for _, l := range ledgers {
+		if l.ID == id {
+			return l, nil
+		}
+	}
+	return Ledger{}, fmt.Errorf("ledger with ID %s not found", id)
+}
+
+func (s *jsonStore) AddLedger(ledger Ledger) (Ledger, error) {
+	if err := ledger.Validate(); err != nil {
+		return Ledger{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readLedgersFile(s.ledgersPath)
+	if err != nil {
+		return Ledger{}, fmt.Errorf("failed to read ledgers file: %v", err)
+	}
+	if ledger.ID == "" {
+		ledger.ID = uuid.New().String()
+	}
+	if ledger.CreatedAt.IsZero() {
+		ledger.CreatedAt = time.Now()
+	}
+	if err := createLedgerFiles(ledgerDir(s.rootPath, ledger.ID)); err != nil {
+		return Ledger{}, err
+	}
+	data.Ledgers = append(data.Ledgers, ledger)
+	log.Printf("Added ledger %s\n", ledger.Name)
+	return ledger, s.writeLedgersFile(s.ledgersPath, data)
+}
+
+func (s *jsonStore) UpdateLedger(id string, ledger Ledger) error {
+	if err := ledger.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readLedgersFile(s.ledgersPath)
+	if err != nil {
+		return fmt.Errorf("failed to read ledgers file: %v", err)
+	}
+	for i, l := range data.Ledgers {
+		if l.ID == id {
+			data.Ledgers[i].Name = ledger.Name
+			data.Ledgers[i].Members = ledger.Members
+			return s.writeLedgersFile(s.ledgersPath, data)
+		}
+	}
+	return fmt.Errorf("ledger with ID %s not found", id)
+}
+
+func (s *jsonStore) RemoveLedger(id string) error {
+	if id == DefaultLedgerID {
+		return fmt.Errorf("the default ledger cannot be removed")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readLedgersFile(s.ledgersPath)
+	if err != nil {
+		return fmt.Errorf("failed to read ledgers file: %v", err)
+	}
+	index := slices.IndexFunc(data.Ledgers, func(l Ledger) bool { return l.ID == id })
+	if index < 0 {
+		return fmt.Errorf("ledger with ID %s not found", id)
+	}
+	data.Ledgers = slices.Delete(data.Ledgers, index, index+1)
+	ledgersWrite, err := newFileWrite(s.rootPath, s.ledgersPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ledgers file: %v", err)
+	}
+	// the files go only once the ledger is gone from the list, and recovery finishes the removal after a crash
+	dir, err := filepath.Rel(s.rootPath, ledgerDir(s.rootPath, id))
+	if err != nil {
+		return fmt.Errorf("failed to resolve ledger directory: %v", err)
+	}
+	err = commitJournal(s.rootPath, journal{Writes: []fileWrite{ledgersWrite}, Removes: []string{dir}})
+	s.cache.forget(ledgerDir(s.rootPath, id))
+	if err != nil {
+		return err
+	}
+	s.cache.store(s.ledgersPath, data.clone())
+	return nil
+}
+
+func (s *jsonStore) ReplaceLedgerData(data LedgerData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data.normalize()
+	config := data.Config
+	if err := s.writeLedgerFiles(&expensesFileData{Expenses: data.Expenses}, &config, &ratesFileData{Rates: data.ExchangeRates}); err != nil {
+		return err
+	}
+	s.defaults["currency"] = config.Currency
+	s.defaults["start_date"] = fmt.Sprintf("%d", config.StartDate)
+	log.Printf("Replaced ledger data with %d expenses\n", len(data.Expenses))
+	return nil
+}
+
+// Users and Sessions
+
+func (s *jsonStore) GetUsers() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %v", err)
+	}
+	if data.Users == nil {
+		return []User{}, nil
+	}
+	return data.Users, nil
+}
+
+func (s *jsonStore) GetUser(id string) (User, error) {
+	users, err := s.GetUsers()
+	if err != nil {
+		return User{}, err
+	}
+	for _, u := range users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return User{}, fmt.Errorf("user with ID %s not found", id)
+}
+
+func (s *jsonStore) GetUserByName(username string) (User, error) {
+	users, err := s.GetUsers()
+	if err != nil {
+		return User{}, err
+	}
+	for _, u := range users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return User{}, fmt.Errorf("user %s not found", username)
+}
+
+func (s *jsonStore) AddUser(user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to read users file: %v", err)
+	}
+	for _, u := range data.Users {
+		if u.Username == user.Username {
+			return User{}, fmt.Errorf("user %s already exists", user.Username)
+		}
+	}
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	data.Users = append(data.Users, user)
+	log.Printf("Added user %s\n", user.Username)
+	return user, s.writeAuthFile(s.authPath, data)
+}
+
+func (s *jsonStore) UpdateUser(id string, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %v", err)
+	}
+	for i, u := range data.Users {
+		if u.ID == id {
+			user.ID = id
+			user.Username = u.Username
+			user.CreatedAt = u.CreatedAt
+			data.Users[i] = user
+			return s.writeAuthFile(s.authPath, data)
+		}
+	}
+	return fmt.Errorf("user with ID %s not found", id)
+}
+
+func (s *jsonStore) RemoveUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %v", err)
+	}
+	index := slices.IndexFunc(data.Users, func(u User) bool { return u.ID == id })
+	if index < 0 {
+		return fmt.Errorf("user with ID %s not found", id)
+	}
+	data.Users = slices.Delete(data.Users, index, index+1)
+	data.Sessions = slices.DeleteFunc(data.Sessions, func(session Session) bool { return session.UserID == id })
+	data.Tokens = slices.DeleteFunc(data.Tokens, func(token APIToken) bool { return token.UserID == id })
+	return s.writeAuthFile(s.authPath, data)
+}
+
+func (s *jsonStore) GetSession(id string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to read users file: %v", err)
+	}
+	for _, session := range data.Sessions {
+		if session.ID == id && session.ExpiresAt.After(time.Now()) {
+			return session, nil
+		}
+	}
+	return Session{}, fmt.Errorf("session not found")
+}
+
+func (s *jsonStore) AddSession(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %v", err)
+	}
+	now := time.Now()
+	data.Sessions = slices.DeleteFunc(data.Sessions, func(session Session) bool { return !session.ExpiresAt.After(now) })
+	data.Sessions = append(data.Sessions, session)
+	return s.writeAuthFile(s.authPath, data)
+}
+
+func (s *jsonStore) RemoveSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %v", err)
+	}
+	data.Sessions = slices.DeleteFunc(data.Sessions, func(session Session) bool { return session.ID == id })
+	return s.writeAuthFile(s.authPath, data)
+}
+
+func (s *jsonStore) RemoveUserSessions(userID, keepID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %v", err)
+	}
+	data.Sessions = slices.DeleteFunc(data.Sessions, func(session Session) bool {
+		return session.UserID == userID && session.ID != keepID
+	})
+	return s.writeAuthFile(s.authPath, data)
+}
+
+func (s *jsonStore) GetAPITokens(userID string) ([]APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %v", err)
+	}
+	tokens := []APIToken{}
+	for _, t := range data.Tokens {
+		if userID == "" || t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *jsonStore) GetAPITokenByHash(hash string) (APIToken, error) {
+	tokens, err := s.GetAPITokens("")
+	if err != nil {
+		return APIToken{}, err
+	}
+	for _, t := range tokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return APIToken{}, fmt.Errorf("token not found")
+}
+
+func (s *jsonStore) AddAPIToken(token APIToken) (APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return APIToken{}, fmt.Errorf("failed to read users file: %v", err)
+	}
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	data.Tokens = append(data.Tokens, token)
+	return token, s.writeAuthFile(s.authPath, data)
+}
+
+func (s *jsonStore) TouchAPIToken(id string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %v", err)
+	}
+	for i, t := range data.Tokens {
+		if t.ID == id {
+			data.Tokens[i].LastUsedAt = usedAt
+			return s.writeAuthFile(s.authPath, data)
+		}
+	}
+	return fmt.Errorf("token with ID %s not found", id)
+}
+
+func (s *jsonStore) RemoveAPIToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.readAuthFile(s.authPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %v", err)
+	}
+	index := slices.IndexFunc(data.Tokens, func(t APIToken) bool { return t.ID == id })
+	if index < 0 {
+		return fmt.Errorf("token with ID %s not found", id)
+	}
+	data.Tokens = slices.Delete(data.Tokens, index, index+1)
+	return s.writeAuthFile(s.authPath, data)
 }
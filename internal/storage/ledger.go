@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ledger that existing data belongs to; it always exists and cannot be removed
+const DefaultLedgerID = "default"
+
+// separate set of expenses, recurring rules and config (categories, currency, start date, budgets, rates)
+type Ledger struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   string    `json:"ownerID"` // empty for ledgers every user can access
+	Members   []string  `json:"members"` // IDs of other users the ledger is shared with
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (l *Ledger) Validate() error {
+	l.Name = SanitizeString(l.Name)
+	if l.Name == "" {
+		return fmt.Errorf("ledger 'name' cannot be empty")
+	}
+	if l.Members == nil {
+		l.Members = []string{}
+	}
+	return nil
+}
+
+// reports whether a user may read and write the ledger
+func (l *Ledger) CanAccess(user User) bool {
+	return user.Admin || l.OwnerID == "" || l.OwnerID == user.ID || slices.Contains(l.Members, user.ID)
+}
+
+// reports whether a user may rename, share or delete the ledger
+func (l *Ledger) CanManage(user User) bool {
+	return user.Admin || (l.OwnerID != "" && l.OwnerID == user.ID)
+}
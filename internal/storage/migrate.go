@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// counts and checksum of one ledger, compared between the source and target of a migration
+type LedgerSummary struct {
+	ID                string
+	Name              string
+	Expenses          int
+	RecurringExpenses int
+	Budgets           int
+	ImportProfiles    int
+	CategoryRules     int
+	Tags              int
+	ExchangeRates     int
+	Checksum          string
+}
+
+// counts and checksums of everything a storage holds
+type StorageSummary struct {
+	Users         int
+	APITokens     int
+	UsersChecksum string // users and API tokens
+	Ledgers       []LedgerSummary
+}
+
+// copies every user, API token, ledger and the data of each ledger into an empty storage, keeping
+// all IDs, then summarizes both storages and fails if their counts or checksums differ; with force a
+// non-empty target, such as one left behind by a failed migration, is cleared first
+func Migrate(from, to Storage, force bool) (StorageSummary, error) {
+	if force {
+		if err := clearStorage(to); err != nil {
+			return StorageSummary{}, err
+		}
+	} else if err := checkEmpty(to); err != nil {
+		return StorageSummary{}, fmt.Errorf("%v (use -force to overwrite it)", err)
+	}
+	users, err := from.GetUsers()
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to get users: %v", err)
+	}
+	for _, u := range users {
+		if _, err := to.AddUser(u); err != nil {
+			return StorageSummary{}, fmt.Errorf("failed to copy user %s: %v", u.Username, err)
+		}
+	}
+	tokens, err := from.GetAPITokens("")
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to get API tokens: %v", err)
+	}
+	for _, t := range tokens {
+		if _, err := to.AddAPIToken(t); err != nil {
+			return StorageSummary{}, fmt.Errorf("failed to copy API token %s: %v", t.Name, err)
+		}
+		if !t.LastUsedAt.IsZero() {
+			if err := to.TouchAPIToken(t.ID, t.LastUsedAt); err != nil {
+				return StorageSummary{}, fmt.Errorf("failed to copy API token %s: %v", t.Name, err)
+			}
+		}
+	}
+	ledgers, err := from.GetLedgers()
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to get ledgers: %v", err)
+	}
+	for _, l := range ledgers {
+		if l.ID == DefaultLedgerID {
+			err = to.UpdateLedger(l.ID, l)
+		} else {
+			_, err = to.AddLedger(l)
+		}
+		if err != nil {
+			return StorageSummary{}, fmt.Errorf("failed to copy ledger %s: %v", l.Name, err)
+		}
+		if err := copyLedgerData(from, to, l.ID); err != nil {
+			return StorageSummary{}, fmt.Errorf("failed to copy data of ledger %s: %v", l.Name, err)
+		}
+	}
+
+	source, err := Summarize(from)
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to summarize source: %v", err)
+	}
+	target, err := Summarize(to)
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to summarize target: %v", err)
+	}
+	if diff := source.diff(target); diff != "" {
+		return source, fmt.Errorf("target does not match source: %s", diff)
+	}
+	return source, nil
+}
+
+// migrations only write into a fresh storage, so nothing is overwritten or mixed
+func checkEmpty(s Storage) error {
+	users, err := s.GetUsers()
+	if err != nil {
+		return fmt.Errorf("failed to check target: %v", err)
+	}
+	ledgers, err := s.GetLedgers()
+	if err != nil {
+		return fmt.Errorf("failed to check target: %v", err)
+	}
+	expenses, err := s.GetAllExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to check target: %v", err)
+	}
+	if len(users) > 0 || len(ledgers) > 1 || len(expenses) > 0 {
+		return fmt.Errorf("target storage is not empty: %d users, %d ledgers, %d expenses", len(users), len(ledgers), len(expenses))
+	}
+	return nil
+}
+
+// removes every user, API token and ledger but the default one, whose data the copy replaces anyway
+func clearStorage(s Storage) error {
+	users, err := s.GetUsers()
+	if err != nil {
+		return fmt.Errorf("failed to get target users: %v", err)
+	}
+	for _, u := range users {
+		if err := s.RemoveUser(u.ID); err != nil {
+			return fmt.Errorf("failed to clear target user %s: %v", u.Username, err)
+		}
+	}
+	tokens, err := s.GetAPITokens("")
+	if err != nil {
+		return fmt.Errorf("failed to get target API tokens: %v", err)
+	}
+	for _, t := range tokens {
+		if err := s.RemoveAPIToken(t.ID); err != nil {
+			return fmt.Errorf("failed to clear target API token %s: %v", t.Name, err)
+		}
+	}
+	ledgers, err := s.GetLedgers()
+	if err != nil {
+		return fmt.Errorf("failed to get target ledgers: %v", err)
+	}
+	for _, l := range ledgers {
+		if l.ID == DefaultLedgerID {
+			continue
+		}
+		if err := s.RemoveLedger(l.ID); err != nil {
+			return fmt.Errorf("failed to clear target ledger %s: %v", l.Name, err)
+		}
+	}
+	return nil
+}
+
+func copyLedgerData(from, to Storage, ledgerID string) error {
+	source, err := from.WithLedger(ledgerID)
+	if err != nil {
+		return err
+	}
+	target, err := to.WithLedger(ledgerID)
+	if err != nil {
+		return err
+	}
+	backup, err := CreateBackup(source)
+	if err != nil {
+		return err
+	}
+	return target.ReplaceLedgerData(backup.LedgerData)
+}
+
+// counts everything a storage holds and checksums it in a form that doesn't depend on the backend
+func Summarize(s Storage) (StorageSummary, error) {
+	users, err := s.GetUsers()
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to get users: %v", err)
+	}
+	tokens, err := s.GetAPITokens("")
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to get API tokens: %v", err)
+	}
+	for i := range users {
+		users[i].CreatedAt = canonicalTime(users[i].CreatedAt)
+	}
+	for i := range tokens {
+		tokens[i].CreatedAt = canonicalTime(tokens[i].CreatedAt)
+		tokens[i].LastUsedAt = canonicalTime(tokens[i].LastUsedAt)
+	}
+	slices.SortFunc(users, func(a, b User) int { return cmp.Compare(a.ID, b.ID) })
+	slices.SortFunc(tokens, func(a, b APIToken) int { return cmp.Compare(a.ID, b.ID) })
+	usersChecksum, err := checksum(struct {
+		Users  []User
+		Tokens []APIToken
+	}{users, tokens})
+	if err != nil {
+		return StorageSummary{}, err
+	}
+	summary := StorageSummary{Users: len(users), APITokens: len(tokens), UsersChecksum: usersChecksum}
+
+	ledgers, err := s.GetLedgers()
+	if err != nil {
+		return StorageSummary{}, fmt.Errorf("failed to get ledgers: %v", err)
+	}
+	slices.SortFunc(ledgers, func(a, b Ledger) int { return cmp.Compare(a.ID, b.ID) })
+	for _, l := range ledgers {
+		store, err := s.WithLedger(l.ID)
+		if err != nil {
+			return StorageSummary{}, fmt.Errorf("failed to open ledger %s: %v", l.Name, err)
+		}
+		backup, err := CreateBackup(store)
+		if err != nil {
+			return StorageSummary{}, fmt.Errorf("failed to read ledger %s: %v", l.Name, err)
+		}
+		l.CreatedAt = canonicalTime(l.CreatedAt)
+		if l.ID == DefaultLedgerID {
+			l.CreatedAt = time.Time{} // every storage creates its own default ledger
+		}
+		l.Members = slices.Sorted(slices.Values(l.Members))
+		data := canonicalLedgerData(backup.LedgerData)
+		sum, err := checksum(struct {
+			Ledger Ledger
+			Data   LedgerData
+		}{l, data})
+		if err != nil {
+			return StorageSummary{}, err
+		}
+		summary.Ledgers = append(summary.Ledgers, LedgerSummary{
+			ID:                l.ID,
+			Name:              l.Name,
+			Expenses:          len(data.Expenses),
+			RecurringExpenses: len(data.Config.RecurringExpenses),
+			Budgets:           len(data.Config.Budgets),
+			ImportProfiles:    len(data.Config.ImportProfiles),
+			CategoryRules:     len(data.Config.CategoryRules),
+			Tags:              len(data.Config.Tags),
+			ExchangeRates:     len(data.ExchangeRates),
+			Checksum:          sum,
+		})
+	}
+	return summary, nil
+}
+
+// sorts records by ID and evens out representations that differ between backends without
+// changing the data: time zones, sub-microsecond precision and empty versus missing tags
+func canonicalLedgerData(d LedgerData) LedgerData {
+	d.normalize()
+	c := &d.Config
+	c.RecurringExpenses = slices.Clone(c.RecurringExpenses)
+	for i := range c.RecurringExpenses {
+		c.RecurringExpenses[i].StartDate = canonicalTime(c.RecurringExpenses[i].StartDate)
+		if len(c.RecurringExpenses[i].Tags) == 0 {
+			c.RecurringExpenses[i].Tags = nil
+		}
+	}
+	slices.SortFunc(c.RecurringExpenses, func(a, b RecurringExpense) int { return cmp.Compare(a.ID, b.ID) })
+	c.Budgets = slices.Clone(c.Budgets)
+	for i := range c.Budgets {
+		c.Budgets[i].StartDate = canonicalTime(c.Budgets[i].StartDate)
+	}
+	slices.SortFunc(c.Budgets, func(a, b Budget) int { return cmp.Compare(a.ID, b.ID) })
+	c.ImportProfiles = slices.Clone(c.ImportProfiles)
+	slices.SortFunc(c.ImportProfiles, func(a, b ImportProfile) int { return cmp.Compare(a.ID, b.ID) })
+	c.CategoryRules = slices.Clone(c.CategoryRules) // kept in order, the first matching rule applies
+	for i := range c.CategoryRules {
+		if len(c.CategoryRules[i].Tags) == 0 {
+			c.CategoryRules[i].Tags = nil
+		}
+	}
+	d.Expenses = slices.Clone(d.Expenses)
+	for i := range d.Expenses {
+		d.Expenses[i].Date = canonicalTime(d.Expenses[i].Date)
+		if len(d.Expenses[i].Tags) == 0 {
+			d.Expenses[i].Tags = nil
+		}
+	}
+	slices.SortFunc(d.Expenses, func(a, b Expense) int { return cmp.Compare(a.ID, b.ID) })
+	d.ExchangeRates = slices.Clone(d.ExchangeRates)
+	for i := range d.ExchangeRates {
+		d.ExchangeRates[i].Date = canonicalTime(d.ExchangeRates[i].Date)
+	}
+	slices.SortFunc(d.ExchangeRates, func(a, b ExchangeRate) int {
+		return cmp.Or(cmp.Compare(a.Currency, b.Currency), a.Date.Compare(b.Date))
+	})
+	return d
+}
+
+func canonicalTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func checksum(v any) (string, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal for checksum: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// describes the differences between two summaries, empty when they match
+func (s StorageSummary) diff(other StorageSummary) string {
+	var diffs []string
+	if s.Users != other.Users || s.APITokens != other.APITokens || s.UsersChecksum != other.UsersChecksum {
+		diffs = append(diffs, fmt.Sprintf("users and tokens (%d users, %d tokens vs %d users, %d tokens)", s.Users, s.APITokens, other.Users, other.APITokens))
+	}
+	if len(s.Ledgers) != len(other.Ledgers) {
+		diffs = append(diffs, fmt.Sprintf("%d ledgers vs %d", len(s.Ledgers), len(other.Ledgers)))
+		return strings.Join(diffs, "; ")
+	}
+	for i, l := range s.Ledgers {
+		if l != other.Ledgers[i] {
+			o := other.Ledgers[i]
+			diffs = append(diffs, fmt.Sprintf("ledger %s (%d expenses, %d recurring, checksum %.12s vs %d expenses, %d recurring, checksum %.12s)",
+				l.Name, l.Expenses, l.RecurringExpenses, l.Checksum, o.Expenses, o.RecurringExpenses, o.Checksum))
+		}
+	}
+	return strings.Join(diffs, "; ")
+}
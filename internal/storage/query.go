@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sort orders supported by QueryExpenses
+const (
+	SortDateDesc   = "date_desc"
+	SortDateAsc    = "date_asc"
+	SortAmountDesc = "amount_desc"
+	SortAmountAsc  = "amount_asc"
+	SortNameAsc    = "name_asc"
+	SortNameDesc   = "name_desc"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// filters, ordering and pagination for an expense lookup
+type ExpenseQuery struct {
+	From      time.Time // inclusive, zero for no lower bound
+	To        time.Time // inclusive, zero for no upper bound
+	Category  string
+	Tag       string
+	Name      string // case-insensitive substring match
+	MinAmount *float64
+	MaxAmount *float64
+	Sort      string
+	Limit     int
+	Cursor    string // opaque value from a previous ExpensePage
+}
+
+// one page of expenses returned from QueryExpenses
+type ExpensePage struct {
+	Expenses   []Expense `json:"expenses"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// validates the query and fills in defaults, returning the decoded cursor offset
+func (q *ExpenseQuery) Normalize() (int, error) {
+	if q.Sort == "" {
+		q.Sort = SortDateDesc
+	}
+	if !slices.Contains([]string{SortDateDesc, SortDateAsc, SortAmountDesc, SortAmountAsc, SortNameAsc, SortNameDesc}, q.Sort) {
+		return 0, fmt.Errorf("invalid sort order: %s", q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultQueryLimit
+	}
+	if q.Limit > maxQueryLimit {
+		q.Limit = maxQueryLimit
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return 0, fmt.Errorf("'to' date cannot be before 'from' date")
+	}
+	if q.MinAmount != nil && q.MaxAmount != nil && *q.MaxAmount < *q.MinAmount {
+		return 0, fmt.Errorf("'maxAmount' cannot be less than 'minAmount'")
+	}
+	q.Name = strings.TrimSpace(q.Name)
+	return decodeCursor(q.Cursor)
+}
+
+// reports whether an expense satisfies the query filters
+func (q *ExpenseQuery) Matches(e Expense) bool {
+	if !q.From.IsZero() && e.Date.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && e.Date.After(q.To) {
+		return false
+	}
+	if q.Category != "" && !strings.EqualFold(e.Category, q.Category) {
+		return false
+	}
+	if q.Tag != "" && !slices.ContainsFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, q.Tag) }) {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(e.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.MinAmount != nil && e.Amount < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && e.Amount > *q.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// sorts expenses in place by the query order, using ID as a tiebreaker for stable pages
+func (q *ExpenseQuery) sortExpenses(expenses []Expense) {
+	slices.SortStableFunc(expenses, func(a, b Expense) int {
+		var c int
+		switch q.Sort {
+		case SortDateAsc:
+			c = a.Date.Compare(b.Date)
+		case SortAmountDesc:
+			c = compareFloat(b.Amount, a.Amount)
+		case SortAmountAsc:
+			c = compareFloat(a.Amount, b.Amount)
+		case SortNameAsc:
+			c = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		case SortNameDesc:
+			c = strings.Compare(strings.ToLower(b.Name), strings.ToLower(a.Name))
+		default:
+			c = b.Date.Compare(a.Date)
+		}
+		if c == 0 {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		return c
+	})
+}
+
+// filters, sorts and paginates an in-memory expense list
+func queryExpenseSlice(expenses []Expense, query ExpenseQuery) (ExpensePage, error) {
+	offset, err := query.Normalize()
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	matched := []Expense{}
+	for _, e := range expenses {
+		if query.Matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	query.sortExpenses(matched)
+	page := ExpensePage{Total: len(matched), Expenses: []Expense{}}
+	if offset >= len(matched) {
+		return page, nil
+	}
+	end := min(offset+query.Limit, len(matched))
+	page.Expenses = matched[offset:end]
+	if end < len(matched) {
+		page.NextCursor = encodeCursor(end)
+	}
+	return page, nil
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return offset, nil
+}
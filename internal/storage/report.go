@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// period types supported by PeriodBounds
+const (
+	PeriodMonth   = "month" // honors Config.StartDate as the first day of the month
+	PeriodWeek    = "week"  // Monday through Sunday
+	PeriodQuarter = "quarter"
+	PeriodYear    = "year"
+)
+
+// aggregated totals for a category or tag within a period
+type GroupTotal struct {
+	Name     string  `json:"name"`
+	Expenses float64 `json:"expenses"` // sum of negative amounts, reported as a positive value
+	Income   float64 `json:"income"`
+	Count    int     `json:"count"`
+}
+
+// totals over a date range, matching what the dashboard shows for a month
+type Summary struct {
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Currency   string       `json:"currency"`
+	Income     float64      `json:"income"`
+	Expenses   float64      `json:"expenses"`
+	Net        float64      `json:"net"`
+	Count      int          `json:"count"`
+	Categories []GroupTotal `json:"categories"`
+	Tags       []GroupTotal `json:"tags"`
+	// currencies without a conversion rate, whose amounts were counted unconverted
+	MissingRates []string `json:"missingRates"`
+}
+
+// returns the inclusive bounds of the period of the given type containing ref, in ref's location
+func PeriodBounds(period string, ref time.Time, startDate int) (time.Time, time.Time, error) {
+	loc := ref.Location()
+	year, month, day := ref.Date()
+	var start, next time.Time
+	switch period {
+	case PeriodMonth:
+		start = MonthStart(ref, startDate)
+		next = MonthStart(start.AddDate(0, 0, 31), startDate) // months span 28-31 days, so this lands in the next one
+	case PeriodWeek:
+		offset := (int(ref.Weekday()) + 6) % 7
+		start = time.Date(year, month, day-offset, 0, 0, 0, 0, loc)
+		next = start.AddDate(0, 0, 7)
+	case PeriodQuarter:
+		start = time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, loc)
+		next = start.AddDate(0, 3, 0)
+	case PeriodYear:
+		start = time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+		next = start.AddDate(1, 0, 0)
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period: '%s'. Must be one of 'month', 'week', 'quarter', or 'year'", period)
+	}
+	return start, next.Add(-time.Nanosecond), nil
+}
+
+// returns the first instant of the start-date aligned month containing ref,
+// clamping the start day to the length of shorter months like the dashboard does
+func MonthStart(ref time.Time, startDate int) time.Time {
+	if startDate < 1 {
+		startDate = 1
+	}
+	loc := ref.Location()
+	year, month, day := ref.Date()
+	thisStart := min(startDate, daysIn(year, month))
+	if day >= thisStart {
+		return time.Date(year, month, thisStart, 0, 0, 0, 0, loc)
+	}
+	prev := time.Date(year, month-1, 1, 0, 0, 0, 0, loc)
+	return time.Date(prev.Year(), prev.Month(), min(startDate, daysIn(prev.Year(), prev.Month())), 0, 0, 0, 0, loc)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// aggregates an in-memory expense list over an inclusive date range, in the converter's base currency
+func summarizeExpenses(expenses []Expense, from, to time.Time, converter *Converter) Summary {
+	summary := Summary{From: from, To: to, Currency: converter.Base, MissingRates: []string{}}
+	categories := map[string]*GroupTotal{}
+	tags := map[string]*GroupTotal{}
+	for _, e := range expenses {
+		if e.Date.Before(from) || e.Date.After(to) || e.Type == TypeSettlement {
+			continue
+		}
+		amount, ok := converter.Convert(e.Amount, e.Currency, e.Date)
+		if !ok && !slices.Contains(summary.MissingRates, e.Currency) {
+			summary.MissingRates = append(summary.MissingRates, e.Currency)
+		}
+		summary.Count++
+		if amount > 0 {
+			summary.Income += amount
+		} else {
+			summary.Expenses -= amount
+		}
+		addToGroup(categories, e.Category, amount)
+		for _, tag := range e.Tags {
+			addToGroup(tags, tag, amount)
+		}
+	}
+	slices.Sort(summary.MissingRates)
+	summary.Net = summary.Income - summary.Expenses
+	summary.Categories = sortedGroups(categories)
+	summary.Tags = sortedGroups(tags)
+	return summary
+}
+
+func addToGroup(groups map[string]*GroupTotal, name string, amount float64) {
+	group, ok := groups[name]
+	if !ok {
+		group = &GroupTotal{Name: name}
+		groups[name] = group
+	}
+	if amount > 0 {
+		group.Income += amount
+	} else {
+		group.Expenses -= amount
+	}
+	group.Count++
+}
+
+// orders groups by expenses descending, then by name
+func sortedGroups(groups map[string]*GroupTotal) []GroupTotal {
+	result := make([]GroupTotal, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	slices.SortFunc(result, func(a, b GroupTotal) int {
+		if c := compareFloat(b.Expenses, a.Expenses); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return result
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// assigns a category and tags to expenses matching all of its conditions; rules are tried in order
+// and the first one that matches is applied
+type CategoryRule struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	NameContains string   `json:"nameContains"` // case-insensitive substring of the expense name
+	NamePattern  string   `json:"namePattern"`  // regular expression matched against the expense name
+	MinAmount    *float64 `json:"minAmount"`    // amounts are compared without their sign
+	MaxAmount    *float64 `json:"maxAmount"`
+	Currency     string   `json:"currency"`
+	Tag          string   `json:"tag"`      // tag the expense already has
+	Category     string   `json:"category"` // assigned category, empty keeps the expense's own
+	Tags         []string `json:"tags"`     // added tags
+}
+
+func (r *CategoryRule) Validate() error {
+	r.Name = SanitizeString(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("rule 'name' cannot be empty")
+	}
+	r.NameContains = strings.TrimSpace(r.NameContains)
+	r.NamePattern = strings.TrimSpace(r.NamePattern)
+	if r.NamePattern != "" {
+		if _, err := regexp.Compile(r.NamePattern); err != nil {
+			return fmt.Errorf("invalid rule 'namePattern': %v", err)
+		}
+	}
+	if r.MinAmount != nil && r.MaxAmount != nil && *r.MinAmount > *r.MaxAmount {
+		return fmt.Errorf("rule 'minAmount' cannot be greater than 'maxAmount'")
+	}
+	r.Currency = strings.ToLower(strings.TrimSpace(r.Currency))
+	if r.Currency != "" && !slices.Contains(SupportedCurrencies, r.Currency) {
+		return fmt.Errorf("invalid currency: %s", r.Currency)
+	}
+	r.Tag = SanitizeString(r.Tag)
+	if r.NameContains == "" && r.NamePattern == "" && r.MinAmount == nil && r.MaxAmount == nil && r.Currency == "" && r.Tag == "" {
+		return fmt.Errorf("rule must have at least one condition")
+	}
+	if r.Category != "" {
+		category, err := ValidateCategory(r.Category)
+		if err != nil {
+			return err
+		}
+		r.Category = category
+	}
+	var tags []string
+	for _, tag := range r.Tags {
+		if tag = SanitizeString(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	r.Tags = tags
+	if r.Category == "" && len(r.Tags) == 0 {
+		return fmt.Errorf("rule must assign a category or tags")
+	}
+	return nil
+}
+
+// rules with their name patterns compiled, to apply them to many expenses
+type RuleSet struct {
+	rules    []CategoryRule
+	patterns []*regexp.Regexp
+}
+
+func NewRuleSet(rules []CategoryRule) (*RuleSet, error) {
+	set := &RuleSet{rules: rules, patterns: make([]*regexp.Regexp, len(rules))}
+	for i, r := range rules {
+		if r.NamePattern == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(r.NamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of rule '%s': %v", r.Name, err)
+		}
+		set.patterns[i] = pattern
+	}
+	return set, nil
+}
+
+func (s *RuleSet) Rules() []CategoryRule {
+	return s.rules
+}
+
+// applies the first matching rule to the expense and returns its index, or -1 when no rule matches;
+// settlements between members are never categorized
+func (s *RuleSet) Apply(e *Expense) int {
+	for i := range s.rules {
+		if s.matches(i, e) {
+			s.rules[i].apply(e)
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *RuleSet) matches(i int, e *Expense) bool {
+	r := &s.rules[i]
+	if e.Type == TypeSettlement {
+		return false
+	}
+	if r.NameContains != "" && !strings.Contains(strings.ToLower(e.Name), strings.ToLower(r.NameContains)) {
+		return false
+	}
+	if s.patterns[i] != nil && !s.patterns[i].MatchString(e.Name) {
+		return false
+	}
+	amount := math.Abs(e.Amount)
+	if (r.MinAmount != nil && amount < *r.MinAmount) || (r.MaxAmount != nil && amount > *r.MaxAmount) {
+		return false
+	}
+	if r.Currency != "" && r.Currency != e.Currency {
+		return false
+	}
+	if r.Tag != "" && !slices.ContainsFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, r.Tag) }) {
+		return false
+	}
+	return true
+}
+
+func (r *CategoryRule) apply(e *Expense) {
+	if r.Category != "" {
+		e.Category = r.Category
+	}
+	for _, tag := range r.Tags {
+		if !slices.ContainsFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			e.Tags = append(slices.Clip(e.Tags), tag)
+		}
+	}
+}
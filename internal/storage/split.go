@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// expense types
+const (
+	TypeExpense    = ""           // regular expense or income
+	TypeSettlement = "settlement" // repayment between members, left out of spending totals
+)
+
+// ways a shared expense can be divided
+const (
+	SplitEqual   = "equal"
+	SplitPercent = "percent"
+	SplitExact   = "exact"
+)
+
+// category given to settlements recorded without one
+const settlementCategory = "Settlement"
+
+// how a shared expense is divided between named members
+type Split struct {
+	Method string  `json:"method"`
+	Shares []Share `json:"shares"`
+}
+
+type Share struct {
+	Member string  `json:"member"`
+	Value  float64 `json:"value"` // percentage for percent splits, amount for exact splits, ignored for equal splits
+}
+
+// what a member paid and owes across a ledger's shared expenses, in the base currency
+type MemberBalance struct {
+	Member string  `json:"member"`
+	Paid   float64 `json:"paid"`  // shared expenses paid plus settlements sent
+	Share  float64 `json:"share"` // shares of shared expenses plus settlements received
+	Net    float64 `json:"net"`   // positive when the member is owed money
+}
+
+// payment from one member to another
+type Transfer struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+type Balances struct {
+	Currency     string          `json:"currency"`
+	Members      []MemberBalance `json:"members"`
+	SettleUp     []Transfer      `json:"settleUp"` // suggested transfers that bring every balance to zero
+	MissingRates []string        `json:"missingRates"`
+}
+
+// normalizes member names and checks the shares against the (absolute) expense amount
+func (sp *Split) Validate(amount float64) error {
+	if sp.Method == "" {
+		sp.Method = SplitEqual
+	}
+	if !slices.Contains([]string{SplitEqual, SplitPercent, SplitExact}, sp.Method) {
+		return fmt.Errorf("invalid split method: '%s'. Must be one of 'equal', 'percent', or 'exact'", sp.Method)
+	}
+	if len(sp.Shares) == 0 {
+		return fmt.Errorf("split must have at least one member")
+	}
+	seen := map[string]bool{}
+	var total float64
+	for i := range sp.Shares {
+		share := &sp.Shares[i]
+		share.Member = SanitizeString(share.Member)
+		if share.Member == "" {
+			return fmt.Errorf("split member cannot be empty")
+		}
+		if seen[strings.ToLower(share.Member)] {
+			return fmt.Errorf("split member '%s' is listed more than once", share.Member)
+		}
+		seen[strings.ToLower(share.Member)] = true
+		if sp.Method == SplitEqual {
+			share.Value = 0
+			continue
+		}
+		if share.Value < 0 {
+			return fmt.Errorf("split share for '%s' cannot be negative", share.Member)
+		}
+		total += share.Value
+	}
+	switch sp.Method {
+	case SplitPercent:
+		if math.Abs(total-100) > 0.001 {
+			return fmt.Errorf("split percentages must add up to 100, got %g", total)
+		}
+	case SplitExact:
+		if math.Abs(total-amount) > 0.005 {
+			return fmt.Errorf("split shares must add up to the amount %.2f, got %.2f", amount, total)
+		}
+	}
+	return nil
+}
+
+// divides an amount between the members in cents, with exact shares scaled to the amount so they
+// survive currency conversion; rounding leftovers go to the first members so the shares always add up
+func (sp *Split) Amounts(amount float64) map[string]float64 {
+	weights := make([]float64, len(sp.Shares))
+	var totalWeight float64
+	for i, share := range sp.Shares {
+		weights[i] = 1
+		if sp.Method != SplitEqual {
+			weights[i] = share.Value
+		}
+		totalWeight += weights[i]
+	}
+	total := int64(math.Round(amount * 100))
+	cents := make([]int64, len(sp.Shares))
+	var assigned int64
+	for i := range cents {
+		if totalWeight > 0 {
+			cents[i] = int64(float64(total) * weights[i] / totalWeight)
+		}
+		assigned += cents[i]
+	}
+	step := int64(1)
+	if total < assigned {
+		step = -1
+	}
+	for i := 0; assigned != total; i = (i + 1) % len(cents) {
+		cents[i] += step
+		assigned += step
+	}
+	amounts := make(map[string]float64, len(sp.Shares))
+	for i, share := range sp.Shares {
+		amounts[share.Member] = float64(cents[i]) / 100
+	}
+	return amounts
+}
+
+// checks who paid and how the expense is shared; settlements must name the one member receiving them
+func (e *Expense) validateSplit() error {
+	e.PaidBy = SanitizeString(e.PaidBy)
+	switch e.Type {
+	case TypeExpense:
+		if e.Split == nil {
+			return nil
+		}
+	case TypeSettlement:
+		if e.Category == "" {
+			e.Category = settlementCategory
+		}
+		if e.Split == nil || len(e.Split.Shares) != 1 {
+			return fmt.Errorf("settlement must have a split with exactly one member receiving it")
+		}
+		e.Split.Method = SplitExact
+		e.Split.Shares[0].Value = math.Abs(e.Amount)
+	default:
+		return fmt.Errorf("invalid expense type: '%s'. Must be empty or 'settlement'", e.Type)
+	}
+	if e.PaidBy == "" {
+		return fmt.Errorf("expense 'paidBy' is required when it is split")
+	}
+	if err := e.Split.Validate(math.Abs(e.Amount)); err != nil {
+		return err
+	}
+	if e.Type == TypeSettlement && strings.EqualFold(e.Split.Shares[0].Member, e.PaidBy) {
+		return fmt.Errorf("settlement must be paid to another member")
+	}
+	return nil
+}
+
+// computes who owes whom across every split expense and settlement in the ledger
+func GetBalances(s Storage) (Balances, error) {
+	expenses, err := s.GetAllExpenses()
+	if err != nil {
+		return Balances{}, err
+	}
+	converter, err := LoadConverter(s)
+	if err != nil {
+		return Balances{}, err
+	}
+	balances := Balances{Currency: converter.Base, Members: []MemberBalance{}, SettleUp: []Transfer{}, MissingRates: []string{}}
+	// members are matched case-insensitively, as in Split.Validate, under the first spelling seen
+	names := map[string]string{}
+	member := func(name string) string {
+		key := strings.ToLower(name)
+		if _, ok := names[key]; !ok {
+			names[key] = name
+		}
+		return names[key]
+	}
+	paid := map[string]int64{}
+	owed := map[string]int64{}
+	for _, e := range expenses {
+		if e.Split == nil || e.PaidBy == "" {
+			continue
+		}
+		amount, ok := converter.Convert(e.Amount, e.Currency, e.Date)
+		if !ok && !slices.Contains(balances.MissingRates, e.Currency) {
+			balances.MissingRates = append(balances.MissingRates, e.Currency)
+		}
+		// expenses are negative, so the payer covered -amount; income shared out flips the direction
+		cost := -amount
+		if e.Type == TypeSettlement {
+			cost = math.Abs(amount)
+		}
+		paid[member(e.PaidBy)] += int64(math.Round(cost * 100))
+		for name, share := range e.Split.Amounts(cost) {
+			owed[member(name)] += int64(math.Round(share * 100))
+		}
+	}
+	net := map[string]int64{}
+	for member, cents := range paid {
+		net[member] += cents
+	}
+	for member, cents := range owed {
+		net[member] -= cents
+	}
+	for member, cents := range net {
+		balances.Members = append(balances.Members, MemberBalance{
+			Member: member,
+			Paid:   float64(paid[member]) / 100,
+			Share:  float64(owed[member]) / 100,
+			Net:    float64(cents) / 100,
+		})
+	}
+	slices.SortFunc(balances.Members, func(a, b MemberBalance) int { return cmp.Compare(a.Member, b.Member) })
+	slices.Sort(balances.MissingRates)
+	balances.SettleUp = settleUp(net)
+	return balances, nil
+}
+
+// pairs the largest debtor with the largest creditor until every balance is zero, which needs
+// at most one transfer fewer than there are members with a balance
+func settleUp(net map[string]int64) []Transfer {
+	type balance struct {
+		member string
+		cents  int64
+	}
+	var creditors, debtors []balance
+	for member, cents := range net {
+		if cents > 0 {
+			creditors = append(creditors, balance{member, cents})
+		} else if cents < 0 {
+			debtors = append(debtors, balance{member, -cents})
+		}
+	}
+	byAmount := func(a, b balance) int {
+		return cmp.Or(cmp.Compare(b.cents, a.cents), cmp.Compare(a.member, b.member))
+	}
+	transfers := []Transfer{}
+	for len(creditors) > 0 && len(debtors) > 0 {
+		slices.SortFunc(creditors, byAmount)
+		slices.SortFunc(debtors, byAmount)
+		amount := min(creditors[0].cents, debtors[0].cents)
+		transfers = append(transfers, Transfer{From: debtors[0].member, To: creditors[0].member, Amount: float64(amount) / 100})
+		creditors[0].cents -= amount
+		debtors[0].cents -= amount
+		if creditors[0].cents == 0 {
+			creditors = creditors[1:]
+		}
+		if debtors[0].cents == 0 {
+			debtors = debtors[1:]
+		}
+	}
+	return transfers
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetBalancesMatchesMembersIgnoringCase(t *testing.T) {
+	store, err := InitializeJsonStore(SystemConfig{StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expense := Expense{
+		Name:     "Dinner",
+		Category: "Food",
+		Amount:   -20,
+		Currency: "usd",
+		Date:     time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		PaidBy:   "Alice",
+		Split:    &Split{Method: SplitEqual, Shares: []Share{{Member: "alice"}, {Member: "Bob"}}},
+	}
+	if err := expense.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatal(err)
+	}
+	balances, err := GetBalances(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MemberBalance{
+		{Member: "Alice", Paid: 20, Share: 10, Net: 10},
+		{Member: "Bob", Paid: 0, Share: 10, Net: -10},
+	}
+	if len(balances.Members) != len(want) {
+		t.Fatalf("GetBalances() members = %+v, want %+v", balances.Members, want)
+	}
+	for i := range want {
+		if balances.Members[i] != want[i] {
+			t.Errorf("GetBalances() member %d = %+v, want %+v", i, balances.Members[i], want[i])
+		}
+	}
+	if len(balances.SettleUp) != 1 || balances.SettleUp[0] != (Transfer{From: "Bob", To: "Alice", Amount: 10}) {
+		t.Errorf("GetBalances() settle up = %+v, want Bob paying Alice 10", balances.SettleUp)
+	}
+}
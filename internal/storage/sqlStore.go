@@ -0,0 +1,1660 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sqlStore implements the Storage interface over database/sql, shared by the PostgreSQL and
+// SQLite backends. Both drivers accept $N placeholders, so only the SQL in sqlDialect differs.
+// Times are written in UTC so that SQLite's text dates compare in order.
+type sqlStore struct {
+	db       *sql.DB
+	dialect  sqlDialect
+	ledgerID string            // every expense, recurring rule, config row and rate is scoped to this ledger
+	defaults map[string]string // allows reusing defaults without querying for config
+}
+
+// the parts of the SQL that differ between the backends
+type sqlDialect struct {
+	// conditions on an expense row, formatted with the index of the bound tag or name
+	tagFilterSQL  string
+	nameFilterSQL string
+	// condition matching ids in the list bound to $1, and how to bind the list
+	idListSQL string
+	idListArg func(ids []string) (any, error)
+	// appended to a SELECT in a transaction to lock the rows it reads
+	lockRowSQL string
+	// bulk inserts expenses that already have their defaults filled in
+	insertExpenses func(tx *sql.Tx, ledgerID string, expenses []Expense) error
+	// summary queries taking $1 and $2 as the date range, $3 as the base currency and $4 as the ledger
+	summaryTotalsSQL     string
+	summaryCategoriesSQL string
+	summaryTagsSQL       string
+	summaryMissingSQL    string
+	// rows of tag, expense count and recurring expense count for the ledger bound to $1
+	tagCountsSQL string
+}
+
+func newSQLStore(db *sql.DB, dialect sqlDialect, ledgerID string) (*sqlStore, error) {
+	store := &sqlStore{db: db, dialect: dialect, ledgerID: ledgerID, defaults: map[string]string{}}
+	// a store is opened per request, so only the two defaults are read instead of the whole config
+	var currency string
+	var startDate int
+	err := db.QueryRow(`SELECT currency, start_date FROM config WHERE id = $1`, ledgerID).Scan(&currency, &startDate)
+	if err == sql.ErrNoRows {
+		// GetConfig creates the default config for a ledger that has none yet
+		config, err := store.GetConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %v", err)
+		}
+		currency, startDate = config.Currency, config.StartDate
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+	store.defaults["currency"] = currency
+	store.defaults["start_date"] = fmt.Sprintf("%d", startDate)
+	return store, nil
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) saveConfig(config *Config) error {
+	if err := s.writeConfig(s.db, config); err != nil {
+		return err
+	}
+	s.setDefaults(config)
+	return nil
+}
+
+// callers writing the config in a transaction call this once it commits
+func (s *sqlStore) setDefaults(config *Config) {
+	s.defaults["currency"] = config.Currency
+	s.defaults["start_date"] = fmt.Sprintf("%d", config.StartDate)
+}
+
+func (s *sqlStore) writeConfig(db sqlExecutor, config *Config) error {
+	categoriesJSON, err := json.Marshal(config.Categories)
+	if err != nil {
+		return fmt.Errorf("failed to marshal categories: %v", err)
+	}
+	if config.Budgets == nil {
+		config.Budgets = []Budget{}
+	}
+	budgetsJSON, err := json.Marshal(config.Budgets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal budgets: %v", err)
+	}
+	if config.ImportProfiles == nil {
+		config.ImportProfiles = []ImportProfile{}
+	}
+	profilesJSON, err := json.Marshal(config.ImportProfiles)
+	if err != nil {
+		return fmt.Errorf("failed to marshal import profiles: %v", err)
+	}
+	if config.CategoryRules == nil {
+		config.CategoryRules = []CategoryRule{}
+	}
+	rulesJSON, err := json.Marshal(config.CategoryRules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal category rules: %v", err)
+	}
+	if config.Tags == nil {
+		config.Tags = []Tag{}
+	}
+	tagsJSON, err := json.Marshal(config.Tags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tags: %v", err)
+	}
+	query := `
+		INSERT INTO config (id, categories, currency, start_date, budgets, import_profiles, category_rules, tags)
+		VALUES ($8, $1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			categories = excluded.categories,
+			currency = excluded.currency,
+			start_date = excluded.start_date,
+			budgets = excluded.budgets,
+			import_profiles = excluded.import_profiles,
+			category_rules = excluded.category_rules,
+			tags = excluded.tags;
+	`
+	_, err = db.Exec(query, string(categoriesJSON), config.Currency, config.StartDate, string(budgetsJSON), string(profilesJSON), string(rulesJSON), string(tagsJSON), s.ledgerID)
+	return err
+}
+
+func (s *sqlStore) updateConfig(updater func(c *Config) error) error {
+	return s.updateConfigTx(func(tx *sql.Tx, c *Config) error {
+		return updater(c)
+	})
+}
+
+// reads the config with its row locked, so concurrent updates wait for each other instead of
+// overwriting one another, and writes it back with whatever else the updater changed in tx
+func (s *sqlStore) updateConfigTx(updater func(tx *sql.Tx, c *Config) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	config, err := s.readConfig(tx, true)
+	if err != nil {
+		return err
+	}
+	if err := updater(tx, config); err != nil {
+		return err
+	}
+	if err := s.writeConfig(tx, config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	s.setDefaults(config)
+	return nil
+}
+
+func (s *sqlStore) GetConfig() (*Config, error) {
+	return s.readConfig(s.db, false)
+}
+
+func (s *sqlStore) readConfig(db sqlExecutor, forUpdate bool) (*Config, error) {
+	query := `SELECT categories, currency, start_date, budgets, import_profiles, category_rules, tags FROM config WHERE id = $1`
+	if forUpdate {
+		query += s.dialect.lockRowSQL
+	}
+	var categoriesStr, currency, budgetsStr, profilesStr, rulesStr, tagsStr string
+	var startDate int
+	err := db.QueryRow(query, s.ledgerID).Scan(&categoriesStr, &currency, &startDate, &budgetsStr, &profilesStr, &rulesStr, &tagsStr)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			config := &Config{}
+			config.SetBaseConfig()
+			if err := s.writeConfig(db, config); err != nil {
+				return nil, fmt.Errorf("failed to save initial default config: %v", err)
+			}
+			return config, nil
+		}
+		return nil, fmt.Errorf("failed to get config from db: %v", err)
+	}
+
+	var config Config
+	config.Currency = currency
+	config.StartDate = startDate
+	if err := json.Unmarshal([]byte(categoriesStr), &config.Categories); err != nil {
+		return nil, fmt.Errorf("failed to parse categories from db: %v", err)
+	}
+	if err := json.Unmarshal([]byte(budgetsStr), &config.Budgets); err != nil {
+		return nil, fmt.Errorf("failed to parse budgets from db: %v", err)
+	}
+	if err := json.Unmarshal([]byte(profilesStr), &config.ImportProfiles); err != nil {
+		return nil, fmt.Errorf("failed to parse import profiles from db: %v", err)
+	}
+	if err := json.Unmarshal([]byte(rulesStr), &config.CategoryRules); err != nil {
+		return nil, fmt.Errorf("failed to parse category rules from db: %v", err)
+	}
+	if err := json.Unmarshal([]byte(tagsStr), &config.Tags); err != nil {
+		return nil, fmt.Errorf("failed to parse tags from db: %v", err)
+	}
+
+	recurring, err := s.getRecurringExpenses(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring expenses for config: %v", err)
+	}
+	config.RecurringExpenses = recurring
+
+	conversions, err := s.getConversions(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversions for config: %v", err)
+	}
+	config.Conversions = conversions
+
+	return &config, nil
+}
+
+func (s *sqlStore) GetCategories() ([]string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Categories, nil
+}
+
+func (s *sqlStore) UpdateCategories(categories []string) error {
+	return s.updateConfig(func(c *Config) error {
+		c.Categories = categories
+		return nil
+	})
+}
+
+// renames the category on every expense and recurring expense using it and in the config in one
+// transaction, merging it into to if the ledger already has that category
+func (s *sqlStore) RenameCategory(from, to string) error {
+	to, err := ValidateCategory(to)
+	if err != nil {
+		return err
+	}
+	return s.updateConfigTx(func(tx *sql.Tx, config *Config) error {
+		rows, err := tx.Query(`SELECT DISTINCT category FROM expenses WHERE ledger_id = $1`, s.ledgerID)
+		if err != nil {
+			return fmt.Errorf("failed to query expense categories: %v", err)
+		}
+		var categories []string
+		for rows.Next() {
+			var category string
+			if err := rows.Scan(&category); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan expense category: %v", err)
+			}
+			categories = append(categories, category)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to iterate expense categories: %v", err)
+		}
+		for _, category := range categorySpellings(categories, from) {
+			if _, err := tx.Exec(`UPDATE expenses SET category = $1 WHERE category = $2 AND ledger_id = $3`, to, category, s.ledgerID); err != nil {
+				return fmt.Errorf("failed to update category of expenses: %v", err)
+			}
+		}
+		for _, r := range config.RecurringExpenses {
+			if !strings.EqualFold(r.Category, from) {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE recurring_expenses SET category = $1 WHERE id = $2 AND ledger_id = $3`, to, r.ID, s.ledgerID); err != nil {
+				return fmt.Errorf("failed to update category of recurring expense: %v", err)
+			}
+		}
+		config.recategorize(from, to)
+		return nil
+	})
+}
+
+func (s *sqlStore) GetCurrency() (string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	return config.Currency, nil
+}
+
+func (s *sqlStore) UpdateCurrency(currency string) error {
+	if !slices.Contains(SupportedCurrencies, currency) {
+		return fmt.Errorf("invalid currency: %s", currency)
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.Currency = currency
+		return nil
+	})
+}
+
+func (s *sqlStore) GetStartDate() (int, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return 0, err
+	}
+	return config.StartDate, nil
+}
+
+func (s *sqlStore) UpdateStartDate(startDate int) error {
+	if startDate < 1 || startDate > 31 {
+		return fmt.Errorf("invalid start date: %d", startDate)
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.StartDate = startDate
+		return nil
+	})
+}
+
+func (s *sqlStore) GetBudgets() ([]Budget, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Budgets, nil
+}
+
+func (s *sqlStore) AddBudget(budget Budget) (Budget, error) {
+	if err := budget.Validate(); err != nil {
+		return Budget{}, err
+	}
+	budget.ID = uuid.New().String()
+	if budget.StartDate.IsZero() {
+		budget.StartDate = time.Now()
+	}
+	err := s.updateConfig(func(c *Config) error {
+		if BudgetConflicts(c.Budgets, budget) {
+			return fmt.Errorf("a budget for '%s' already exists", budget.Target())
+		}
+		c.Budgets = append(c.Budgets, budget)
+		return nil
+	})
+	if err != nil {
+		return Budget{}, err
+	}
+	return budget, nil
+}
+
+func (s *sqlStore) UpdateBudget(id string, budget Budget) error {
+	if err := budget.Validate(); err != nil {
+		return err
+	}
+	budget.ID = id
+	return s.updateConfig(func(c *Config) error {
+		if BudgetConflicts(c.Budgets, budget) {
+			return fmt.Errorf("a budget for '%s' already exists", budget.Target())
+		}
+		for i, b := range c.Budgets {
+			if b.ID == id {
+				if budget.StartDate.IsZero() {
+					budget.StartDate = b.StartDate
+				}
+				c.Budgets[i] = budget
+				return nil
+			}
+		}
+		return fmt.Errorf("budget with ID %s not found", id)
+	})
+}
+
+func (s *sqlStore) RemoveBudget(id string) error {
+	return s.updateConfig(func(c *Config) error {
+		for i, b := range c.Budgets {
+			if b.ID == id {
+				c.Budgets = slices.Delete(c.Budgets, i, i+1)
+				return nil
+			}
+		}
+		return fmt.Errorf("budget with ID %s not found", id)
+	})
+}
+
+func (s *sqlStore) GetImportProfiles() ([]ImportProfile, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.ImportProfiles, nil
+}
+
+func (s *sqlStore) AddImportProfile(profile ImportProfile) (ImportProfile, error) {
+	if err := profile.Validate(); err != nil {
+		return ImportProfile{}, err
+	}
+	profile.ID = uuid.New().String()
+	err := s.updateConfig(func(c *Config) error {
+		if importProfileConflicts(c.ImportProfiles, profile) {
+			return fmt.Errorf("an import profile named '%s' already exists", profile.Name)
+		}
+		c.ImportProfiles = append(c.ImportProfiles, profile)
+		return nil
+	})
+	if err != nil {
+		return ImportProfile{}, err
+	}
+	return profile, nil
+}
+
+func (s *sqlStore) UpdateImportProfile(id string, profile ImportProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	profile.ID = id
+	return s.updateConfig(func(c *Config) error {
+		if importProfileConflicts(c.ImportProfiles, profile) {
+			return fmt.Errorf("an import profile named '%s' already exists", profile.Name)
+		}
+		for i, p := range c.ImportProfiles {
+			if p.ID == id {
+				c.ImportProfiles[i] = profile
+				return nil
+			}
+		}
+		return fmt.Errorf("import profile with ID %s not found", id)
+	})
+}
+
+func (s *sqlStore) RemoveImportProfile(id string) error {
+	return s.updateConfig(func(c *Config) error {
+		for i, p := range c.ImportProfiles {
+			if p.ID == id {
+				c.ImportProfiles = slices.Delete(c.ImportProfiles, i, i+1)
+				return nil
+			}
+		}
+		return fmt.Errorf("import profile with ID %s not found", id)
+	})
+}
+
+func (s *sqlStore) GetCategoryRules() ([]CategoryRule, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.CategoryRules, nil
+}
+
+func (s *sqlStore) AddCategoryRule(rule CategoryRule) (CategoryRule, error) {
+	if err := rule.Validate(); err != nil {
+		return CategoryRule{}, err
+	}
+	rule.ID = uuid.New().String()
+	err := s.updateConfig(func(c *Config) error {
+		c.CategoryRules = append(c.CategoryRules, rule)
+		return nil
+	})
+	if err != nil {
+		return CategoryRule{}, err
+	}
+	return rule, nil
+}
+
+func (s *sqlStore) UpdateCategoryRule(id string, rule CategoryRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	rule.ID = id
+	return s.updateConfig(func(c *Config) error {
+		for i, r := range c.CategoryRules {
+			if r.ID == id {
+				c.CategoryRules[i] = rule
+				return nil
+			}
+		}
+		return fmt.Errorf("category rule with ID %s not found", id)
+	})
+}
+
+func (s *sqlStore) RemoveCategoryRule(id string) error {
+	return s.updateConfig(func(c *Config) error {
+		for i, r := range c.CategoryRules {
+			if r.ID == id {
+				c.CategoryRules = slices.Delete(c.CategoryRules, i, i+1)
+				return nil
+			}
+		}
+		return fmt.Errorf("category rule with ID %s not found", id)
+	})
+}
+
+func (s *sqlStore) GetTags() ([]Tag, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Tags, nil
+}
+
+func (s *sqlStore) GetTagCounts() ([]TagCount, error) {
+	rows, err := s.db.Query(s.dialect.tagCountsSQL, s.ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tags: %v", err)
+	}
+	defer rows.Close()
+	counts := []TagCount{}
+	for rows.Next() {
+		var c TagCount
+		if err := rows.Scan(&c.Name, &c.Expenses, &c.RecurringExpenses); err != nil {
+			return nil, fmt.Errorf("failed to scan tag count: %v", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (s *sqlStore) UpdateTags(tags []Tag) error {
+	tags, err := ValidateTags(tags)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.Tags = tags
+		return nil
+	})
+}
+
+func (s *sqlStore) RenameTag(from, to string) error {
+	if to = SanitizeString(to); to == "" {
+		return fmt.Errorf("tag name cannot be empty")
+	}
+	return s.retag(from, to)
+}
+
+func (s *sqlStore) RemoveTag(name string) error {
+	return s.retag(name, "")
+}
+
+// rewrites the tag on every expense and recurring rule carrying it and in the config, in one transaction
+func (s *sqlStore) retag(from, to string) error {
+	return s.updateConfigTx(func(tx *sql.Tx, config *Config) error {
+		rows, err := tx.Query(`SELECT id, tags FROM expenses WHERE ledger_id = $1`, s.ledgerID)
+		if err != nil {
+			return fmt.Errorf("failed to query expense tags: %v", err)
+		}
+		updates := map[string][]string{}
+		for rows.Next() {
+			var id string
+			var tagsStr sql.NullString
+			if err := rows.Scan(&id, &tagsStr); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan expense tags: %v", err)
+			}
+			var tags []string
+			if tagsStr.Valid && tagsStr.String != "" {
+				if err := json.Unmarshal([]byte(tagsStr.String), &tags); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to parse tags for expense %s: %v", id, err)
+				}
+			}
+			if tags, changed := retag(tags, from, to); changed {
+				updates[id] = tags
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to iterate expense tags: %v", err)
+		}
+		for id, tags := range updates {
+			tagsJSON, _ := json.Marshal(tags)
+			if _, err := tx.Exec(`UPDATE expenses SET tags = $1 WHERE id = $2 AND ledger_id = $3`, string(tagsJSON), id, s.ledgerID); err != nil {
+				return fmt.Errorf("failed to update tags of expense: %v", err)
+			}
+		}
+		for _, r := range config.RecurringExpenses {
+			tags, changed := retag(r.Tags, from, to)
+			if !changed {
+				continue
+			}
+			tagsJSON, _ := json.Marshal(tags)
+			if _, err := tx.Exec(`UPDATE recurring_expenses SET tags = $1 WHERE id = $2 AND ledger_id = $3`, string(tagsJSON), r.ID, s.ledgerID); err != nil {
+				return fmt.Errorf("failed to update tags of recurring expense: %v", err)
+			}
+		}
+		config.retag(from, to)
+		return nil
+	})
+}
+
+// Expenses
+
+const expenseColumnsSQL = `id, recurring_id, name, category, amount, currency, date, tags, type, paid_by, split`
+
+func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
+	var expense Expense
+	var tagsStr sql.NullString
+	var recurringID sql.NullString
+	var splitStr string
+	err := scanner.Scan(&expense.ID, &recurringID, &expense.Name, &expense.Category, &expense.Amount, &expense.Currency, &expense.Date, &tagsStr, &expense.Type, &expense.PaidBy, &splitStr)
+	if err != nil {
+		return Expense{}, err
+	}
+	if recurringID.Valid {
+		expense.RecurringID = recurringID.String
+	}
+	if tagsStr.Valid && tagsStr.String != "" {
+		if err := json.Unmarshal([]byte(tagsStr.String), &expense.Tags); err != nil {
+			return Expense{}, fmt.Errorf("failed to parse tags for expense %s: %v", expense.ID, err)
+		}
+	}
+	if err := json.Unmarshal([]byte(splitStr), &expense.Split); err != nil {
+		return Expense{}, fmt.Errorf("failed to parse split for expense %s: %v", expense.ID, err)
+	}
+	return expense, nil
+}
+
+func (s *sqlStore) GetAllExpenses() ([]Expense, error) {
+	query := `SELECT ` + expenseColumnsSQL + ` FROM expenses WHERE ledger_id = $1 ORDER BY date DESC`
+	rows, err := s.db.Query(query, s.ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+
+	var expenses []Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %v", err)
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, rows.Err()
+}
+
+func (s *sqlStore) buildExpenseFilter(query ExpenseQuery) (string, []any) {
+	var clauses []string
+	var args []any
+	add := func(clause string, arg any) {
+		args = append(args, arg)
+		clauses = append(clauses, fmt.Sprintf(clause, len(args)))
+	}
+	add("ledger_id = $%d", s.ledgerID)
+	if !query.From.IsZero() {
+		add("date >= $%d", query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		add("date <= $%d", query.To.UTC())
+	}
+	if query.Category != "" {
+		add("LOWER(category) = LOWER($%d)", query.Category)
+	}
+	if query.Tag != "" {
+		add(s.dialect.tagFilterSQL, query.Tag)
+	}
+	if query.Name != "" {
+		add(s.dialect.nameFilterSQL, query.Name)
+	}
+	if query.MinAmount != nil {
+		add("amount >= $%d", *query.MinAmount)
+	}
+	if query.MaxAmount != nil {
+		add("amount <= $%d", *query.MaxAmount)
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+func expenseOrderSQL(sort string) string {
+	switch sort {
+	case SortDateAsc:
+		return " ORDER BY date ASC, id ASC"
+	case SortAmountDesc:
+		return " ORDER BY amount DESC, id ASC"
+	case SortAmountAsc:
+		return " ORDER BY amount ASC, id ASC"
+	case SortNameAsc:
+		return " ORDER BY LOWER(name) ASC, id ASC"
+	case SortNameDesc:
+		return " ORDER BY LOWER(name) DESC, id ASC"
+	default:
+		return " ORDER BY date DESC, id ASC"
+	}
+}
+
+func (s *sqlStore) QueryExpenses(query ExpenseQuery) (ExpensePage, error) {
+	offset, err := query.Normalize()
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	where, args := s.buildExpenseFilter(query)
+	page := ExpensePage{Expenses: []Expense{}}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM expenses`+where, args...).Scan(&page.Total); err != nil {
+		return ExpensePage{}, fmt.Errorf("failed to count expenses: %v", err)
+	}
+	if offset >= page.Total {
+		return page, nil
+	}
+	args = append(args, query.Limit, offset)
+	selectQuery := `SELECT ` + expenseColumnsSQL + ` FROM expenses` + where +
+		expenseOrderSQL(query.Sort) + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	rows, err := s.db.Query(selectQuery, args...)
+	if err != nil {
+		return ExpensePage{}, fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return ExpensePage{}, fmt.Errorf("failed to scan expense: %v", err)
+		}
+		page.Expenses = append(page.Expenses, expense)
+	}
+	if err := rows.Err(); err != nil {
+		return ExpensePage{}, fmt.Errorf("failed to iterate expenses: %v", err)
+	}
+	if end := offset + len(page.Expenses); end < page.Total {
+		page.NextCursor = encodeCursor(end)
+	}
+	return page, nil
+}
+
+func (s *sqlStore) GetExpense(id string) (Expense, error) {
+	query := `SELECT ` + expenseColumnsSQL + ` FROM expenses WHERE id = $1 AND ledger_id = $2`
+	expense, err := scanExpense(s.db.QueryRow(query, id, s.ledgerID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Expense{}, fmt.Errorf("expense with ID %s not found", id)
+		}
+		return Expense{}, fmt.Errorf("failed to get expense: %v", err)
+	}
+	return expense, nil
+}
+
+// satisfied by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// fills in the id, currency and date of an expense that is about to be stored
+func (s *sqlStore) withDefaults(expense Expense) Expense {
+	if expense.ID == "" {
+		expense.ID = uuid.New().String()
+	}
+	if expense.Currency == "" {
+		expense.Currency = s.defaults["currency"]
+	}
+	if expense.Date.IsZero() {
+		expense.Date = time.Now()
+	}
+	return expense
+}
+
+func insertExpense(db sqlExecutor, ledgerID string, expense Expense) error {
+	tagsJSON, err := json.Marshal(expense.Tags)
+	if err != nil {
+		return err
+	}
+	splitJSON, err := json.Marshal(expense.Split)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, tags, type, paid_by, split, ledger_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err = db.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date.UTC(), string(tagsJSON), expense.Type, expense.PaidBy, string(splitJSON), ledgerID)
+	return err
+}
+
+func (s *sqlStore) AddExpense(expense Expense) error {
+	return insertExpense(s.db, s.ledgerID, s.withDefaults(expense))
+}
+
+func (s *sqlStore) UpdateExpense(id string, expense Expense) error {
+	return s.updateExpense(s.db, id, expense)
+}
+
+func (s *sqlStore) UpdateExpenses(expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	for _, expense := range expenses {
+		if err := s.updateExpense(tx, expense.ID, expense); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) updateExpense(db sqlExecutor, id string, expense Expense) error {
+	tagsJSON, err := json.Marshal(expense.Tags)
+	if err != nil {
+		return err
+	}
+	splitJSON, err := json.Marshal(expense.Split)
+	if err != nil {
+		return err
+	}
+	if expense.Currency == "" {
+		expense.Currency = s.defaults["currency"]
+	}
+	query := `
+		UPDATE expenses
+		SET name = $1, category = $2, amount = $3, currency = $4, date = $5, tags = $6, recurring_id = $7, type = $8, paid_by = $9, split = $10
+		WHERE id = $11 AND ledger_id = $12
+	`
+	result, err := db.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date.UTC(), string(tagsJSON), expense.RecurringID, expense.Type, expense.PaidBy, string(splitJSON), id, s.ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to update expense: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("expense with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqlStore) MergeExpenses(keep Expense, removeID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := s.updateExpense(tx, keep.ID, keep); err != nil {
+		return err
+	}
+	if err := s.removeExpense(tx, removeID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RemoveExpense(id string) error {
+	return s.removeExpense(s.db, id)
+}
+
+func (s *sqlStore) removeExpense(db sqlExecutor, id string) error {
+	result, err := db.Exec(`DELETE FROM expenses WHERE id = $1 AND ledger_id = $2`, id, s.ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete expense: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("expense with ID %s not found", id)
+	}
+	return nil
+}
+
+// inserts expenses within one transaction, so either all of them are added or none are
+func (s *sqlStore) insertExpenses(tx *sql.Tx, expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	prepared := make([]Expense, len(expenses))
+	for i, exp := range expenses {
+		prepared[i] = s.withDefaults(exp)
+	}
+	return s.dialect.insertExpenses(tx, s.ledgerID, prepared)
+}
+
+func (s *sqlStore) AddMultipleExpenses(expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := s.insertExpenses(tx, expenses); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RemoveMultipleExpenses(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	idList, err := s.dialect.idListArg(ids)
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM expenses WHERE ` + s.dialect.idListSQL + ` AND ledger_id = $2`
+	if _, err := s.db.Exec(query, idList, s.ledgerID); err != nil {
+		return fmt.Errorf("failed to delete multiple expenses: %v", err)
+	}
+	return nil
+}
+
+// Recurring Expenses
+
+func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExpense, error) {
+	var re RecurringExpense
+	var tagsStr sql.NullString
+	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr)
+	if err != nil {
+		return RecurringExpense{}, err
+	}
+	if tagsStr.Valid && tagsStr.String != "" {
+		if err := json.Unmarshal([]byte(tagsStr.String), &re.Tags); err != nil {
+			return RecurringExpense{}, fmt.Errorf("failed to parse tags for recurring expense %s: %v", re.ID, err)
+		}
+	}
+	return re, nil
+}
+
+func (s *sqlStore) GetRecurringExpenses() ([]RecurringExpense, error) {
+	return s.getRecurringExpenses(s.db)
+}
+
+func (s *sqlStore) getRecurringExpenses(db sqlExecutor) ([]RecurringExpense, error) {
+	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags FROM recurring_expenses WHERE ledger_id = $1`
+	rows, err := db.Query(query, s.ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring expenses: %v", err)
+	}
+	defer rows.Close()
+	var recurringExpenses []RecurringExpense
+	for rows.Next() {
+		re, err := scanRecurringExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring expense: %v", err)
+		}
+		recurringExpenses = append(recurringExpenses, re)
+	}
+	return recurringExpenses, rows.Err()
+}
+
+func (s *sqlStore) GetRecurringExpense(id string) (RecurringExpense, error) {
+	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags FROM recurring_expenses WHERE id = $1 AND ledger_id = $2`
+	re, err := scanRecurringExpense(s.db.QueryRow(query, id, s.ledgerID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
+		}
+		return RecurringExpense{}, fmt.Errorf("failed to get recurring expense: %v", err)
+	}
+	return re, nil
+}
+
+func (s *sqlStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if recurringExpense.ID == "" {
+		recurringExpense.ID = uuid.New().String()
+	}
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.defaults["currency"]
+	}
+	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	ruleQuery := `
+		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags, ledger_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate.UTC(), recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), s.ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
+	}
+	if err := s.insertExpenses(tx, generateExpensesFromRecurring(recurringExpense, false)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	recurringExpense.ID = id
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.defaults["currency"]
+	}
+	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	ruleQuery := `
+		UPDATE recurring_expenses
+		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, tags = $7, currency = $8
+		WHERE id = $9 AND ledger_id = $10
+	`
+	res, err := tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, recurringExpense.StartDate.UTC(), recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, id, s.ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to update recurring expense rule: %v", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("recurring expense with ID %s not found to update", id)
+	}
+
+	if updateAll {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2`, id, s.ledgerID)
+	} else {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2 AND date > $3`, id, s.ledgerID, time.Now().UTC())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete old expense instances for update: %v", err)
+	}
+	if err := s.insertExpenses(tx, generateExpensesFromRecurring(recurringExpense, !updateAll)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RemoveRecurringExpense(id string, removeAll bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1 AND ledger_id = $2`, id, s.ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete recurring expense rule: %v", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("recurring expense with ID %s not found", id)
+	}
+
+	if removeAll {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2`, id, s.ledgerID)
+	} else {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2 AND date > $3`, id, s.ledgerID, time.Now().UTC())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete expense instances: %v", err)
+	}
+	return tx.Commit()
+}
+
+func generateExpensesFromRecurring(recExp RecurringExpense, fromToday bool) []Expense {
+	var expenses []Expense
+	currentDate := recExp.StartDate
+	today := time.Now()
+	occurrencesToGenerate := recExp.Occurrences
+	if fromToday {
+		for currentDate.Before(today) && (recExp.Occurrences == 0 || occurrencesToGenerate > 0) {
+			switch recExp.Interval {
+			case "daily":
+				currentDate = currentDate.AddDate(0, 0, 1)
+			case "weekly":
+				currentDate = currentDate.AddDate(0, 0, 7)
+			case "monthly":
+				currentDate = currentDate.AddDate(0, 1, 0)
+			case "yearly":
+				currentDate = currentDate.AddDate(1, 0, 0)
+			default:
+				return expenses // Stop if interval is invalid
+			}
+			if recExp.Occurrences > 0 {
+				occurrencesToGenerate--
+			}
+		}
+	}
+	limit := occurrencesToGenerate
+	// if recExp.Occurrences == 0 {
+	// 	limit = 2000 // Heuristic for "indefinite"
+	// }
+
+	for range limit {
+		expense := Expense{
+			ID:          uuid.New().String(),
+			RecurringID: recExp.ID,
+			Name:        recExp.Name,
+			Category:    recExp.Category,
+			Amount:      recExp.Amount,
+			Currency:    recExp.Currency,
+			Date:        currentDate,
+			Tags:        recExp.Tags,
+		}
+		expenses = append(expenses, expense)
+		switch recExp.Interval {
+		case "daily":
+			currentDate = currentDate.AddDate(0, 0, 1)
+		case "weekly":
+			currentDate = currentDate.AddDate(0, 0, 7)
+		case "monthly":
+			currentDate = currentDate.AddDate(0, 1, 0)
+		case "yearly":
+			currentDate = currentDate.AddDate(1, 0, 0)
+		default:
+			return expenses
+		}
+	}
+	return expenses
+}
+
+// Reports
+
+func (s *sqlStore) GetSummary(from, to time.Time) (Summary, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return Summary{}, err
+	}
+	args := []any{from.UTC(), to.UTC(), config.Currency, s.ledgerID}
+	summary := Summary{From: from, To: to, Currency: config.Currency, MissingRates: []string{}}
+	if err := s.db.QueryRow(s.dialect.summaryTotalsSQL, args...).Scan(&summary.Count, &summary.Income, &summary.Expenses); err != nil {
+		return Summary{}, fmt.Errorf("failed to aggregate expenses: %v", err)
+	}
+	summary.Net = summary.Income - summary.Expenses
+
+	if summary.Categories, err = s.queryGroupTotals(s.dialect.summaryCategoriesSQL, args...); err != nil {
+		return Summary{}, fmt.Errorf("failed to aggregate categories: %v", err)
+	}
+	if summary.Tags, err = s.queryGroupTotals(s.dialect.summaryTagsSQL, args...); err != nil {
+		return Summary{}, fmt.Errorf("failed to aggregate tags: %v", err)
+	}
+
+	rows, err := s.db.Query(s.dialect.summaryMissingSQL, args...)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to find missing conversion rates: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currency string
+		if err := rows.Scan(&currency); err != nil {
+			return Summary{}, fmt.Errorf("failed to scan currency: %v", err)
+		}
+		summary.MissingRates = append(summary.MissingRates, currency)
+	}
+	return summary, rows.Err()
+}
+
+func (s *sqlStore) queryGroupTotals(query string, args ...any) ([]GroupTotal, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	groups := map[string]*GroupTotal{}
+	for rows.Next() {
+		var g GroupTotal
+		if err := rows.Scan(&g.Name, &g.Expenses, &g.Income, &g.Count); err != nil {
+			return nil, err
+		}
+		groups[g.Name] = &g
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortedGroups(groups), nil
+}
+
+// Multi-currency
+
+func (s *sqlStore) GetConversions() (map[string]float64, error) {
+	return s.getConversions(s.db)
+}
+
+func (s *sqlStore) getConversions(db sqlExecutor) (map[string]float64, error) {
+	rows, err := db.Query(`SELECT currency, rate FROM conversions WHERE ledger_id = $1`, s.ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversions: %v", err)
+	}
+	defer rows.Close()
+	conversions := map[string]float64{}
+	for rows.Next() {
+		var currency string
+		var rate float64
+		if err := rows.Scan(&currency, &rate); err != nil {
+			return nil, fmt.Errorf("failed to scan conversion: %v", err)
+		}
+		conversions[currency] = rate
+	}
+	return conversions, rows.Err()
+}
+
+func (s *sqlStore) UpdateConversions(conversions map[string]float64) error {
+	conversions, err := ValidateConversions(conversions)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM conversions WHERE ledger_id = $1`, s.ledgerID); err != nil {
+		return fmt.Errorf("failed to clear conversions: %v", err)
+	}
+	for currency, rate := range conversions {
+		if _, err := tx.Exec(`INSERT INTO conversions (ledger_id, currency, rate) VALUES ($1, $2, $3)`, s.ledgerID, currency, rate); err != nil {
+			return fmt.Errorf("failed to insert conversion for %s: %v", currency, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetExchangeRates(currency string) ([]ExchangeRate, error) {
+	query := `SELECT currency, date, rate FROM exchange_rates WHERE ledger_id = $2 AND ($1 = '' OR currency = $1) ORDER BY currency, date`
+	rows, err := s.db.Query(query, currency, s.ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exchange rates: %v", err)
+	}
+	defer rows.Close()
+	rates := []ExchangeRate{}
+	for rows.Next() {
+		var r ExchangeRate
+		if err := rows.Scan(&r.Currency, &r.Date, &r.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %v", err)
+		}
+		r.Date = RateDate(r.Date)
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+func (s *sqlStore) AddExchangeRates(rates []ExchangeRate) error {
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			return err
+		}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`
+		INSERT INTO exchange_rates (ledger_id, currency, date, rate) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ledger_id, currency, date) DO UPDATE SET rate = excluded.rate
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare exchange rate insert: %v", err)
+	}
+	defer stmt.Close()
+	for _, r := range rates {
+		if _, err := stmt.Exec(s.ledgerID, r.Currency, r.Date.Format("2006-01-02"), r.Rate); err != nil {
+			return fmt.Errorf("failed to insert exchange rate for %s: %v", r.Currency, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RemoveExchangeRate(currency string, date time.Time) error {
+	date = RateDate(date)
+	result, err := s.db.Exec(`DELETE FROM exchange_rates WHERE ledger_id = $3 AND currency = $1 AND date = $2`, currency, date.Format("2006-01-02"), s.ledgerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete exchange rate: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("exchange rate for %s on %s not found", currency, date.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// Ledgers
+
+func (s *sqlStore) WithLedger(id string) (Storage, error) {
+	if id == "" {
+		id = DefaultLedgerID
+	}
+	if _, err := s.GetLedger(id); err != nil {
+		return nil, err
+	}
+	return newSQLStore(s.db, s.dialect, id)
+}
+
+func scanLedger(scanner interface{ Scan(...any) error }) (Ledger, error) {
+	var l Ledger
+	var membersStr string
+	if err := scanner.Scan(&l.ID, &l.Name, &l.OwnerID, &membersStr, &l.CreatedAt); err != nil {
+		return Ledger{}, err
+	}
+	if err := json.Unmarshal([]byte(membersStr), &l.Members); err != nil {
+		return Ledger{}, fmt.Errorf("failed to parse members for ledger %s: %v", l.ID, err)
+	}
+	return l, nil
+}
+
+func (s *sqlStore) GetLedgers() ([]Ledger, error) {
+	rows, err := s.db.Query(`SELECT id, name, owner_id, members, created_at FROM ledgers ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledgers: %v", err)
+	}
+	defer rows.Close()
+	ledgers := []Ledger{}
+	for rows.Next() {
+		l, err := scanLedger(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ledger: %v", err)
+		}
+		ledgers = append(ledgers, l)
+	}
+	return ledgers, rows.Err()
+}
+
+func (s *sqlStore) GetLedger(id string) (Ledger, error) {
+	l, err := scanLedger(s.db.QueryRow(`SELECT id, name, owner_id, members, created_at FROM ledgers WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Ledger{}, fmt.Errorf("ledger with ID %s not found", id)
+		}
+		return Ledger{}, fmt.Errorf("failed to get ledger: %v", err)
+	}
+	return l, nil
+}
+
+func (s *sqlStore) AddLedger(ledger Ledger) (Ledger, error) {
+	if err := ledger.Validate(); err != nil {
+		return Ledger{}, err
+	}
+	if ledger.ID == "" {
+		ledger.ID = uuid.New().String()
+	}
+	if ledger.CreatedAt.IsZero() {
+		ledger.CreatedAt = time.Now()
+	}
+	membersJSON, err := json.Marshal(ledger.Members)
+	if err != nil {
+		return Ledger{}, fmt.Errorf("failed to marshal members: %v", err)
+	}
+	query := `INSERT INTO ledgers (id, name, owner_id, members, created_at) VALUES ($1, $2, $3, $4, $5)`
+	if _, err := s.db.Exec(query, ledger.ID, ledger.Name, ledger.OwnerID, string(membersJSON), ledger.CreatedAt.UTC()); err != nil {
+		return Ledger{}, fmt.Errorf("failed to insert ledger: %v", err)
+	}
+	// creates the ledger's config row with the base config
+	if _, err := newSQLStore(s.db, s.dialect, ledger.ID); err != nil {
+		return Ledger{}, err
+	}
+	return ledger, nil
+}
+
+func (s *sqlStore) UpdateLedger(id string, ledger Ledger) error {
+	if err := ledger.Validate(); err != nil {
+		return err
+	}
+	membersJSON, err := json.Marshal(ledger.Members)
+	if err != nil {
+		return fmt.Errorf("failed to marshal members: %v", err)
+	}
+	result, err := s.db.Exec(`UPDATE ledgers SET name = $1, members = $2 WHERE id = $3`, ledger.Name, string(membersJSON), id)
+	if err != nil {
+		return fmt.Errorf("failed to update ledger: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("ledger with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqlStore) RemoveLedger(id string) error {
+	if id == DefaultLedgerID {
+		return fmt.Errorf("the default ledger cannot be removed")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`DELETE FROM ledgers WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete ledger: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("ledger with ID %s not found", id)
+	}
+	for _, query := range []string{
+		`DELETE FROM expenses WHERE ledger_id = $1`,
+		`DELETE FROM recurring_expenses WHERE ledger_id = $1`,
+		`DELETE FROM conversions WHERE ledger_id = $1`,
+		`DELETE FROM exchange_rates WHERE ledger_id = $1`,
+		`DELETE FROM config WHERE id = $1`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return fmt.Errorf("failed to delete ledger data: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) ReplaceLedgerData(data LedgerData) error {
+	data.normalize()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM expenses WHERE ledger_id = $1`,
+		`DELETE FROM recurring_expenses WHERE ledger_id = $1`,
+		`DELETE FROM conversions WHERE ledger_id = $1`,
+		`DELETE FROM exchange_rates WHERE ledger_id = $1`,
+	} {
+		if _, err := tx.Exec(query, s.ledgerID); err != nil {
+			return fmt.Errorf("failed to clear ledger data: %v", err)
+		}
+	}
+	config := data.Config
+	if err := s.writeConfig(tx, &config); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	for _, re := range config.RecurringExpenses {
+		tagsJSON, _ := json.Marshal(re.Tags)
+		query := `
+			INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags, ledger_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+		if _, err := tx.Exec(query, re.ID, re.Name, re.Amount, re.Currency, re.Category, re.StartDate.UTC(), re.Interval, re.Occurrences, string(tagsJSON), s.ledgerID); err != nil {
+			return fmt.Errorf("failed to insert recurring expense rule: %v", err)
+		}
+	}
+	for currency, rate := range config.Conversions {
+		if _, err := tx.Exec(`INSERT INTO conversions (ledger_id, currency, rate) VALUES ($1, $2, $3)`, s.ledgerID, currency, rate); err != nil {
+			return fmt.Errorf("failed to insert conversion for %s: %v", currency, err)
+		}
+	}
+	for _, r := range data.ExchangeRates {
+		if _, err := tx.Exec(`INSERT INTO exchange_rates (ledger_id, currency, date, rate) VALUES ($1, $2, $3, $4)`, s.ledgerID, r.Currency, r.Date.Format("2006-01-02"), r.Rate); err != nil {
+			return fmt.Errorf("failed to insert exchange rate for %s: %v", r.Currency, err)
+		}
+	}
+	if err := s.insertExpenses(tx, data.Expenses); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	s.setDefaults(&config)
+	return nil
+}
+
+// Users and Sessions
+
+const userColumnsSQL = `id, username, password_hash, admin, created_at`
+
+func scanUser(scanner interface{ Scan(...any) error }) (User, error) {
+	var u User
+	err := scanner.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Admin, &u.CreatedAt)
+	return u, err
+}
+
+func (s *sqlStore) GetUsers() ([]User, error) {
+	rows, err := s.db.Query(`SELECT ` + userColumnsSQL + ` FROM users ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %v", err)
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) GetUser(id string) (User, error) {
+	u, err := scanUser(s.db.QueryRow(`SELECT `+userColumnsSQL+` FROM users WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, fmt.Errorf("user with ID %s not found", id)
+		}
+		return User{}, fmt.Errorf("failed to get user: %v", err)
+	}
+	return u, nil
+}
+
+func (s *sqlStore) GetUserByName(username string) (User, error) {
+	u, err := scanUser(s.db.QueryRow(`SELECT `+userColumnsSQL+` FROM users WHERE username = $1`, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, fmt.Errorf("user %s not found", username)
+		}
+		return User{}, fmt.Errorf("failed to get user: %v", err)
+	}
+	return u, nil
+}
+
+func (s *sqlStore) AddUser(user User) (User, error) {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	query := `INSERT INTO users (` + userColumnsSQL + `) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (username) DO NOTHING`
+	result, err := s.db.Exec(query, user.ID, user.Username, user.PasswordHash, user.Admin, user.CreatedAt.UTC())
+	if err != nil {
+		return User{}, fmt.Errorf("failed to insert user: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return User{}, fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return User{}, fmt.Errorf("user %s already exists", user.Username)
+	}
+	return user, nil
+}
+
+func (s *sqlStore) UpdateUser(id string, user User) error {
+	result, err := s.db.Exec(`UPDATE users SET password_hash = $1, admin = $2 WHERE id = $3`, user.PasswordHash, user.Admin, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqlStore) RemoveUser(id string) error {
+	// sessions and tokens are removed by the foreign key cascade
+	result, err := s.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqlStore) GetSession(id string) (Session, error) {
+	var session Session
+	query := `SELECT id, user_id, csrf_token, expires_at FROM sessions WHERE id = $1 AND expires_at > $2`
+	err := s.db.QueryRow(query, id, time.Now().UTC()).Scan(&session.ID, &session.UserID, &session.CSRFToken, &session.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Session{}, fmt.Errorf("session not found")
+		}
+		return Session{}, fmt.Errorf("failed to get session: %v", err)
+	}
+	return session, nil
+}
+
+func (s *sqlStore) AddSession(session Session) error {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at <= $1`, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to remove expired sessions: %v", err)
+	}
+	query := `INSERT INTO sessions (id, user_id, csrf_token, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := s.db.Exec(query, session.ID, session.UserID, session.CSRFToken, session.ExpiresAt.UTC()); err != nil {
+		return fmt.Errorf("failed to insert session: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) RemoveSession(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) RemoveUserSessions(userID, keepID string) error {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, keepID); err != nil {
+		return fmt.Errorf("failed to delete sessions: %v", err)
+	}
+	return nil
+}
+
+const apiTokenColumnsSQL = `id, user_id, name, hash, scope, created_at, last_used_at`
+
+func scanAPIToken(scanner interface{ Scan(...any) error }) (APIToken, error) {
+	var t APIToken
+	var lastUsed sql.NullTime
+	if err := scanner.Scan(&t.ID, &t.UserID, &t.Name, &t.Hash, &t.Scope, &t.CreatedAt, &lastUsed); err != nil {
+		return APIToken{}, err
+	}
+	t.LastUsedAt = lastUsed.Time
+	return t, nil
+}
+
+func (s *sqlStore) GetAPITokens(userID string) ([]APIToken, error) {
+	query := `SELECT ` + apiTokenColumnsSQL + ` FROM api_tokens WHERE $1 = '' OR user_id = $1 ORDER BY created_at`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %v", err)
+	}
+	defer rows.Close()
+	tokens := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token: %v", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlStore) GetAPITokenByHash(hash string) (APIToken, error) {
+	t, err := scanAPIToken(s.db.QueryRow(`SELECT `+apiTokenColumnsSQL+` FROM api_tokens WHERE hash = $1`, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return APIToken{}, fmt.Errorf("token not found")
+		}
+		return APIToken{}, fmt.Errorf("failed to get token: %v", err)
+	}
+	return t, nil
+}
+
+func (s *sqlStore) AddAPIToken(token APIToken) (APIToken, error) {
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	query := `INSERT INTO api_tokens (id, user_id, name, hash, scope, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err := s.db.Exec(query, token.ID, token.UserID, token.Name, token.Hash, token.Scope, token.CreatedAt.UTC()); err != nil {
+		return APIToken{}, fmt.Errorf("failed to insert token: %v", err)
+	}
+	return token, nil
+}
+
+func (s *sqlStore) TouchAPIToken(id string, usedAt time.Time) error {
+	if _, err := s.db.Exec(`UPDATE api_tokens SET last_used_at = $1 WHERE id = $2`, usedAt.UTC(), id); err != nil {
+		return fmt.Errorf("failed to update token: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) RemoveAPIToken(id string) error {
+	result, err := s.db.Exec(`DELETE FROM api_tokens WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("token with ID %s not found", id)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// name of the database file within the storage directory
+const sqliteFileName = "expenseowl.db"
+
+// same schema semantics as the PostgreSQL store
+const (
+	createSQLiteSchemaSQL = `
+	CREATE TABLE IF NOT EXISTS ledgers (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		owner_id TEXT NOT NULL DEFAULT '',
+		members TEXT NOT NULL DEFAULT '[]',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO ledgers (id, name) VALUES ('default', 'Default') ON CONFLICT (id) DO NOTHING;
+
+	CREATE TABLE IF NOT EXISTS expenses (
+		id TEXT NOT NULL,
+		ledger_id TEXT NOT NULL DEFAULT 'default',
+		recurring_id TEXT,
+		name TEXT NOT NULL,
+		category TEXT NOT NULL,
+		amount NUMERIC NOT NULL,
+		currency TEXT NOT NULL,
+		date DATETIME NOT NULL,
+		tags TEXT,
+		type TEXT NOT NULL DEFAULT '',
+		paid_by TEXT NOT NULL DEFAULT '',
+		split TEXT NOT NULL DEFAULT 'null',
+		PRIMARY KEY (ledger_id, id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_expenses_ledger_date ON expenses (ledger_id, date);
+	CREATE INDEX IF NOT EXISTS idx_expenses_ledger_category ON expenses (ledger_id, category);
+	CREATE INDEX IF NOT EXISTS idx_expenses_recurring_id ON expenses (recurring_id);
+
+	CREATE TABLE IF NOT EXISTS recurring_expenses (
+		id TEXT NOT NULL,
+		ledger_id TEXT NOT NULL DEFAULT 'default',
+		name TEXT NOT NULL,
+		amount NUMERIC NOT NULL,
+		currency TEXT NOT NULL,
+		category TEXT NOT NULL,
+		start_date DATETIME NOT NULL,
+		interval TEXT NOT NULL,
+		occurrences INTEGER NOT NULL,
+		tags TEXT,
+		PRIMARY KEY (ledger_id, id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_recurring_expenses_ledger ON recurring_expenses (ledger_id);
+
+	CREATE TABLE IF NOT EXISTS config (
+		id TEXT PRIMARY KEY DEFAULT 'default',
+		categories TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		start_date INTEGER NOT NULL,
+		budgets TEXT NOT NULL DEFAULT '[]',
+		import_profiles TEXT NOT NULL DEFAULT '[]',
+		category_rules TEXT NOT NULL DEFAULT '[]',
+		tags TEXT NOT NULL DEFAULT '[]'
+	);
+
+	CREATE TABLE IF NOT EXISTS conversions (
+		ledger_id TEXT NOT NULL DEFAULT 'default',
+		currency TEXT NOT NULL,
+		rate REAL NOT NULL,
+		PRIMARY KEY (ledger_id, currency)
+	);
+
+	CREATE TABLE IF NOT EXISTS exchange_rates (
+		ledger_id TEXT NOT NULL DEFAULT 'default',
+		currency TEXT NOT NULL,
+		date DATE NOT NULL,
+		rate REAL NOT NULL,
+		PRIMARY KEY (ledger_id, currency, date)
+	);
+
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		admin BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		csrf_token TEXT NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		scope TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME
+	);`
+
+	// tags are stored as a JSON array string (or "null"), this normalizes them for json_each
+	sqliteTagsArraySQL = `CASE WHEN tags IS NULL OR tags IN ('', 'null') THEN '[]' ELSE tags END`
+
+	// non-settlement expenses of ledger $4 between $1 and $2, converted to the base currency $3 with the
+	// closest prior dated rate, falling back to the static rate
+	sqliteConvertedExpensesSQL = `
+	WITH rated AS (
+		SELECT e.category, e.currency, e.amount, e.tags, c.rate AS static_rate,
+			(SELECT r.rate FROM exchange_rates r
+				WHERE r.ledger_id = e.ledger_id AND r.currency = e.currency AND r.date <= substr(e.date, 1, 10)
+				ORDER BY r.date DESC LIMIT 1) AS dated_rate
+		FROM expenses e
+		LEFT JOIN conversions c ON c.ledger_id = e.ledger_id AND c.currency = e.currency
+		WHERE e.ledger_id = $4 AND e.type <> 'settlement' AND e.date >= $1 AND e.date <= $2
+	), converted AS (
+		SELECT category, currency, tags, dated_rate IS NULL AND static_rate IS NULL AND currency <> $3 AND currency <> '' AS missing,
+			ROUND(amount * CASE WHEN currency = $3 OR currency = '' THEN 1 ELSE COALESCE(dated_rate, static_rate, 1) END, 2) AS amount
+		FROM rated
+	)`
+
+	sqliteGroupColumnsSQL = `
+		COALESCE(SUM(CASE WHEN amount < 0 THEN -amount ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN amount > 0 THEN amount ELSE 0 END), 0),
+		COUNT(*)`
+)
+
+func InitializeSQLiteStore(baseConfig SystemConfig) (Storage, error) {
+	if err := os.MkdirAll(baseConfig.StorageURL, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	path := filepath.Join(baseConfig.StorageURL, sqliteFileName)
+	// WAL keeps readers unblocked during writes, and immediate transactions avoid lock upgrade deadlocks
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_time_format=sqlite&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping SQLite database: %v", err)
+	}
+	log.Printf("Opened SQLite database at %s\n", path)
+
+	if _, err := db.Exec(createSQLiteSchemaSQL); err != nil {
+		return nil, fmt.Errorf("failed to create database tables: %v", err)
+	}
+	return newSQLStore(db, sqliteDialect, DefaultLedgerID)
+}
+
+// SQLite reads tags and id lists with json_each and compares the UTC dates as text
+var sqliteDialect = sqlDialect{
+	tagFilterSQL:  "EXISTS (SELECT 1 FROM json_each(" + sqliteTagsArraySQL + ") AS t WHERE LOWER(t.value) = LOWER($%d))",
+	nameFilterSQL: "instr(LOWER(name), LOWER($%d)) > 0",
+	// an immediate transaction already holds the write lock from its start
+	lockRowSQL:     "",
+	idListSQL:      "id IN (SELECT value FROM json_each($1))",
+	idListArg:      sqliteIDList,
+	insertExpenses: insertSQLiteExpenses,
+	summaryTotalsSQL: sqliteConvertedExpensesSQL + `
+		SELECT COUNT(*),
+			COALESCE(SUM(CASE WHEN amount > 0 THEN amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN amount < 0 THEN -amount ELSE 0 END), 0)
+		FROM converted`,
+	summaryCategoriesSQL: sqliteConvertedExpensesSQL + `
+		SELECT category,` + sqliteGroupColumnsSQL + `
+		FROM converted GROUP BY category`,
+	summaryTagsSQL: sqliteConvertedExpensesSQL + `
+		SELECT t.value,` + sqliteGroupColumnsSQL + `
+		FROM converted, json_each(` + sqliteTagsArraySQL + `) AS t
+		GROUP BY t.value`,
+	summaryMissingSQL: sqliteConvertedExpensesSQL + `SELECT DISTINCT currency FROM converted WHERE missing ORDER BY currency`,
+	tagCountsSQL: `
+		SELECT tag, SUM(expenses), SUM(recurring) FROM (
+			SELECT t.value AS tag, 1 AS expenses, 0 AS recurring
+			FROM expenses, json_each(` + sqliteTagsArraySQL + `) AS t WHERE ledger_id = $1
+			UNION ALL
+			SELECT t.value, 0, 1
+			FROM recurring_expenses, json_each(` + sqliteTagsArraySQL + `) AS t WHERE ledger_id = $1
+		)
+		GROUP BY tag
+		ORDER BY tag`,
+}
+
+// SQLite has no array parameters, so the ids are bound as a JSON array for json_each
+func sqliteIDList(ids []string) (any, error) {
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	return string(idsJSON), nil
+}
+
+// SQLite has no COPY, so expenses are inserted one by one within the caller's transaction
+func insertSQLiteExpenses(tx *sql.Tx, ledgerID string, expenses []Expense) error {
+	for _, exp := range expenses {
+		if err := insertExpense(tx, ledgerID, exp); err != nil {
+			return fmt.Errorf("failed to insert expense: %v", err)
+		}
+	}
+	return nil
+}
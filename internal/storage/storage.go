@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
@@ -13,11 +14,25 @@ type Storage interface {
 	Close() error
 	GetConfig() (*Config, error)
 
+	// Ledgers; all other expense and config methods act on the ledger the storage is scoped to,
+	// which is the default ledger for the storage returned by InitializeStorage
+	WithLedger(id string) (Storage, error) // returns a view scoped to another ledger, sharing this one's connection
+	GetLedgers() ([]Ledger, error)
+	GetLedger(id string) (Ledger, error)
+	AddLedger(ledger Ledger) (Ledger, error)
+	UpdateLedger(id string, ledger Ledger) error
+	RemoveLedger(id string) error            // also removes the ledger's expenses, recurring rules and config
+	ReplaceLedgerData(data LedgerData) error // replaces everything the ledger holds in one step, keeping IDs
+
 	// Basic Config Updates
 	GetCategories() ([]string, error)
 	UpdateCategories(categories []string) error
-	// GetTags() ([]string, error)
-	// UpdateTags(tags []string) error
+	RenameCategory(from, to string) error // renames the category everywhere it is used, merging it into to if that exists
+	GetTags() ([]Tag, error)              // the registry, which may lack tags expenses carry
+	GetTagCounts() ([]TagCount, error)    // how many expenses and recurring expenses carry each tag
+	UpdateTags(tags []Tag) error
+	RenameTag(from, to string) error // renames the tag on expenses, recurring rules, budgets and category rules, merging it into to if that exists
+	RemoveTag(name string) error     // strips the tag from the registry, expenses and recurring rules
 	GetCurrency() (string, error)
 	UpdateCurrency(currency string) error
 	GetStartDate() (int, error)
@@ -32,16 +47,60 @@ type Storage interface {
 
 	// Expenses
 	GetAllExpenses() ([]Expense, error)
+	QueryExpenses(query ExpenseQuery) (ExpensePage, error)
 	GetExpense(id string) (Expense, error)
 	AddExpense(expense Expense) error
 	RemoveExpense(id string) error
-	AddMultipleExpenses(expenses []Expense) error
+	AddMultipleExpenses(expenses []Expense) error // stores all of the expenses or none
 	RemoveMultipleExpenses(ids []string) error
 	UpdateExpense(id string, expense Expense) error
+	UpdateExpenses(expenses []Expense) error           // updates the expenses by their IDs, all of them or none
+	MergeExpenses(keep Expense, removeID string) error // updates the kept expense and removes the other, both or neither
+
+	// Reports
+	GetSummary(from, to time.Time) (Summary, error)
+
+	// Budgets
+	GetBudgets() ([]Budget, error)
+	AddBudget(budget Budget) (Budget, error)
+	UpdateBudget(id string, budget Budget) error
+	RemoveBudget(id string) error
+
+	// Import Profiles
+	GetImportProfiles() ([]ImportProfile, error)
+	AddImportProfile(profile ImportProfile) (ImportProfile, error)
+	UpdateImportProfile(id string, profile ImportProfile) error
+	RemoveImportProfile(id string) error
 
-	// Potential Future Feature: Multi-currency
-	// GetConversions() (map[string]float64, error)
-	// UpdateConversions(conversions map[string]float64) error
+	// Category Rules
+	GetCategoryRules() ([]CategoryRule, error)
+	AddCategoryRule(rule CategoryRule) (CategoryRule, error)
+	UpdateCategoryRule(id string, rule CategoryRule) error
+	RemoveCategoryRule(id string) error
+
+	// Multi-currency
+	GetConversions() (map[string]float64, error)
+	UpdateConversions(conversions map[string]float64) error
+	GetExchangeRates(currency string) ([]ExchangeRate, error) // empty currency for all
+	AddExchangeRates(rates []ExchangeRate) error
+	RemoveExchangeRate(currency string, date time.Time) error
+
+	// Users and Sessions
+	GetUsers() ([]User, error)
+	GetUser(id string) (User, error)
+	GetUserByName(username string) (User, error)
+	AddUser(user User) (User, error)
+	UpdateUser(id string, user User) error
+	RemoveUser(id string) error            // also ends the user's sessions
+	GetSession(id string) (Session, error) // only returns unexpired sessions
+	AddSession(session Session) error
+	RemoveSession(id string) error
+	RemoveUserSessions(userID, keepID string) error // ends the user's sessions other than keepID
+	GetAPITokens(userID string) ([]APIToken, error) // empty userID for all
+	GetAPITokenByHash(hash string) (APIToken, error)
+	AddAPIToken(token APIToken) (APIToken, error)
+	TouchAPIToken(id string, usedAt time.Time) error
+	RemoveAPIToken(id string) error
 }
 
 // config for expense data
@@ -50,7 +109,11 @@ type Config struct {
 	Currency          string             `json:"currency"`
 	StartDate         int                `json:"startDate"`
 	RecurringExpenses []RecurringExpense `json:"recurringExpenses"`
-	// Tags              []string           `json:"tags"`
+	Conversions       map[string]float64 `json:"conversions"` // rates into Currency, keyed by currency code
+	Budgets           []Budget           `json:"budgets"`
+	ImportProfiles    []ImportProfile    `json:"importProfiles"`
+	CategoryRules     []CategoryRule     `json:"categoryRules"`
+	Tags              []Tag              `json:"tags"`
 }
 
 type RecurringExpense struct {
@@ -70,6 +133,7 @@ type BackendType string
 const (
 	BackendTypeJSON     BackendType = "json"
 	BackendTypePostgres BackendType = "postgres"
+	BackendTypeSQLite   BackendType = "sqlite"
 )
 
 // config for the storage backend
@@ -91,14 +155,21 @@ type Expense struct {
 	Amount      float64   `json:"amount"`
 	Currency    string    `json:"currency"`
 	Date        time.Time `json:"date"`
+	Type        string    `json:"type"`   // empty for regular expenses, or TypeSettlement
+	PaidBy      string    `json:"paidBy"` // member who paid, for shared expenses
+	Split       *Split    `json:"split"`  // how a shared expense is divided between members
 }
 
 func (c *Config) SetBaseConfig() {
 	c.Categories = defaultCategories
 	c.Currency = "usd"
 	c.StartDate = 1
-	// c.Tags = []string{}
+	c.Tags = []Tag{}
 	c.RecurringExpenses = []RecurringExpense{}
+	c.Conversions = map[string]float64{}
+	c.Budgets = []Budget{}
+	c.ImportProfiles = []ImportProfile{}
+	c.CategoryRules = []CategoryRule{}
 }
 
 func (c *SystemConfig) SetStorageConfig() {
@@ -115,6 +186,8 @@ func backendTypeFromEnv(env string) BackendType {
 		return BackendTypeJSON
 	case "postgres":
 		return BackendTypePostgres
+	case "sqlite":
+		return BackendTypeSQLite
 	default:
 		return BackendTypeJSON
 	}
@@ -140,11 +213,18 @@ func backendSSLFromEnv(env string) string {
 func InitializeStorage() (Storage, error) {
 	baseConfig := SystemConfig{}
 	baseConfig.SetStorageConfig()
+	return OpenStorage(baseConfig)
+}
+
+// initializes the storage backend described by the config
+func OpenStorage(baseConfig SystemConfig) (Storage, error) {
 	switch baseConfig.StorageType {
 	case BackendTypeJSON:
 		return InitializeJsonStore(baseConfig)
 	case BackendTypePostgres:
 		return InitializePostgresStore(baseConfig)
+	case BackendTypeSQLite:
+		return InitializeSQLiteStore(baseConfig)
 	}
 	return nil, fmt.Errorf("invalid data store: %s", baseConfig.StorageType)
 }
@@ -172,15 +252,20 @@ func (e *Expense) Validate() error {
 	if e.Name == "" {
 		return fmt.Errorf("expense 'name' cannot be empty")
 	}
+	if e.Amount == 0 {
+		return fmt.Errorf("expense 'amount' cannot be 0")
+	}
+	if err := e.validateSplit(); err != nil {
+		return err
+	}
 	if e.Category == "" {
 		return fmt.Errorf("expense 'category' cannot be empty")
 	}
-	if e.Amount == 0 {
-		return fmt.Errorf("expense 'amount' cannot be 0")
+	// an empty currency is filled with the configured default by the store
+	e.Currency = strings.ToLower(strings.TrimSpace(e.Currency))
+	if e.Currency != "" && !slices.Contains(SupportedCurrencies, e.Currency) {
+		return fmt.Errorf("invalid currency: %s", e.Currency)
 	}
-	// if e.Currency == "" {
-	// 	return fmt.Errorf("expense 'currency' cannot be empty")
-	// }
 	if len(e.Tags) > 0 {
 		var cleanedTags []string
 		for _, tag := range e.Tags {
@@ -205,6 +290,10 @@ func (e *RecurringExpense) Validate() error {
 	if e.Category == "" {
 		return fmt.Errorf("recurring expense 'category' cannot be empty")
 	}
+	e.Currency = strings.ToLower(strings.TrimSpace(e.Currency))
+	if e.Currency != "" && !slices.Contains(SupportedCurrencies, e.Currency) {
+		return fmt.Errorf("invalid currency: %s", e.Currency)
+	}
 	if len(e.Tags) > 0 {
 		var cleanedTags []string
 		for _, tag := range e.Tags {
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// category and tags suggested for an expense name
+type Suggestion struct {
+	Category   string   `json:"category"`   // empty when the name has no word seen before
+	Confidence float64  `json:"confidence"` // probability of the category among all categories, from 0 to 1
+	Tags       []string `json:"tags"`
+}
+
+// naive Bayes model of which categories the words of expense names belong to, trained on a
+// ledger's expenses
+type Suggester struct {
+	categoryCounts map[string]int            // expenses per category
+	wordCounts     map[string]map[string]int // occurrences of each word per category
+	wordTotals     map[string]int            // words per category
+	vocabulary     map[string]bool
+	examples       []suggestionExample
+	total          int
+}
+
+type suggestionExample struct {
+	words    []string
+	category string
+	tags     []string
+}
+
+func NewSuggester(expenses []Expense) *Suggester {
+	s := &Suggester{
+		categoryCounts: map[string]int{},
+		wordCounts:     map[string]map[string]int{},
+		wordTotals:     map[string]int{},
+		vocabulary:     map[string]bool{},
+	}
+	for _, e := range expenses {
+		words := nameWords(e.Name)
+		if e.Type == TypeSettlement || e.Category == "" || len(words) == 0 {
+			continue
+		}
+		s.total++
+		s.categoryCounts[e.Category]++
+		if s.wordCounts[e.Category] == nil {
+			s.wordCounts[e.Category] = map[string]int{}
+		}
+		for _, w := range words {
+			s.wordCounts[e.Category][w]++
+			s.wordTotals[e.Category]++
+			s.vocabulary[w] = true
+		}
+		s.examples = append(s.examples, suggestionExample{words: words, category: e.Category, tags: e.Tags})
+	}
+	return s
+}
+
+// suggests the most likely category for the name, and the tags most past expenses of that category
+// sharing a word with the name have
+func (s *Suggester) Suggest(name string) Suggestion {
+	words := slices.DeleteFunc(nameWords(name), func(w string) bool { return !s.vocabulary[w] })
+	if len(words) == 0 {
+		return Suggestion{Tags: []string{}}
+	}
+	// log probabilities with add-one smoothing, turned into a confidence with a softmax
+	scores := make(map[string]float64, len(s.categoryCounts))
+	best, bestScore := "", math.Inf(-1)
+	for category, count := range s.categoryCounts {
+		score := math.Log(float64(count) / float64(s.total))
+		for _, w := range words {
+			score += math.Log(float64(s.wordCounts[category][w]+1) / float64(s.wordTotals[category]+len(s.vocabulary)))
+		}
+		scores[category] = score
+		if score > bestScore || (score == bestScore && category < best) {
+			best, bestScore = category, score
+		}
+	}
+	sum := 0.0
+	for _, score := range scores {
+		sum += math.Exp(score - bestScore)
+	}
+	return Suggestion{Category: best, Confidence: 1 / sum, Tags: s.suggestTags(best, words)}
+}
+
+func (s *Suggester) suggestTags(category string, words []string) []string {
+	matching := 0
+	counts := map[string]int{}
+	var order []string
+	for _, ex := range s.examples {
+		if ex.category != category || !slices.ContainsFunc(words, func(w string) bool { return slices.Contains(ex.words, w) }) {
+			continue
+		}
+		matching++
+		for _, tag := range ex.tags {
+			if counts[tag] == 0 {
+				order = append(order, tag)
+			}
+			counts[tag]++
+		}
+	}
+	tags := []string{}
+	for _, tag := range order {
+		if 2*counts[tag] >= matching {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// lowercase words of a name, leaving out single letters and anything with digits such as the
+// reference numbers banks add to descriptions
+func nameWords(name string) []string {
+	var words []string
+	for _, field := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(field)) < 2 || strings.ContainsFunc(field, unicode.IsDigit) {
+			continue
+		}
+		if !slices.Contains(words, field) {
+			words = append(words, field)
+		}
+	}
+	return words
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tag registered with a ledger; expenses may also carry tags that were never registered
+type Tag struct {
+	Name  string `json:"name"`
+	Color string `json:"color"` // #rrggbb, empty for the default color
+}
+
+// how many expenses and recurring expenses carry a tag, by its exact spelling
+type TagCount struct {
+	Name              string
+	Expenses          int
+	RecurringExpenses int
+}
+
+// counts the tags of the expenses and recurring expenses, in order of first use
+func countTags(expenses []Expense, recurring []RecurringExpense) []TagCount {
+	counts := []TagCount{}
+	index := map[string]int{}
+	count := func(name string) *TagCount {
+		i, ok := index[name]
+		if !ok {
+			i = len(counts)
+			index[name] = i
+			counts = append(counts, TagCount{Name: name})
+		}
+		return &counts[i]
+	}
+	for _, e := range expenses {
+		for _, name := range e.Tags {
+			count(name).Expenses++
+		}
+	}
+	for _, r := range recurring {
+		for _, name := range r.Tags {
+			count(name).RecurringExpenses++
+		}
+	}
+	return counts
+}
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func (t *Tag) Validate() error {
+	t.Name = SanitizeString(t.Name)
+	if t.Name == "" {
+		return fmt.Errorf("tag 'name' cannot be empty")
+	}
+	t.Color = strings.ToLower(strings.TrimSpace(t.Color))
+	if t.Color != "" && !tagColorPattern.MatchString(t.Color) {
+		return fmt.Errorf("invalid tag color: %s, must look like #1a2b3c", t.Color)
+	}
+	return nil
+}
+
+// validates a tag registry, which cannot name a tag twice
+func ValidateTags(tags []Tag) ([]Tag, error) {
+	validated := make([]Tag, 0, len(tags))
+	for _, t := range tags {
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(validated, func(v Tag) bool { return strings.EqualFold(v.Name, t.Name) }) {
+			return nil, fmt.Errorf("duplicate tag: %s", t.Name)
+		}
+		validated = append(validated, t)
+	}
+	return validated, nil
+}
+
+// returns the tags with from, matched case-insensitively, renamed to to, or removed when to is
+// empty, without listing to twice; reports whether anything changed
+func retag(tags []string, from, to string) ([]string, bool) {
+	if !slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, from) }) {
+		return tags, false
+	}
+	var updated []string
+	for _, t := range tags {
+		if strings.EqualFold(t, from) {
+			t = to
+		}
+		if t != "" && !slices.ContainsFunc(updated, func(u string) bool { return strings.EqualFold(u, t) }) {
+			updated = append(updated, t)
+		}
+	}
+	return updated, true
+}
+
+// renames a tag in the registry, budgets and category rules, keeping its color unless it is merged
+// into a registered tag. Removing a tag, with an empty to, also drops its budgets and the rules left
+// assigning nothing, while rules that match on the tag keep that condition rather than matching more
+func (c *Config) retag(from, to string) {
+	tags := slices.Clone(c.Tags)
+	i := slices.IndexFunc(tags, func(t Tag) bool { return strings.EqualFold(t.Name, from) })
+	j := slices.IndexFunc(tags, func(t Tag) bool { return strings.EqualFold(t.Name, to) && !strings.EqualFold(t.Name, from) })
+	switch {
+	case to == "" || (i >= 0 && j >= 0):
+		if i >= 0 {
+			tags = slices.Delete(tags, i, i+1)
+		}
+	case i >= 0:
+		tags[i].Name = to
+	case j < 0:
+		tags = append(tags, Tag{Name: to})
+	}
+	c.Tags = tags
+	isFrom := func(tag string) bool { return tag != "" && strings.EqualFold(tag, from) }
+	if to == "" {
+		c.Budgets = slices.DeleteFunc(slices.Clone(c.Budgets), func(b Budget) bool { return isFrom(b.Tag) })
+	} else {
+		c.Budgets = slices.Clone(c.Budgets)
+		for i := range c.Budgets {
+			if isFrom(c.Budgets[i].Tag) {
+				c.Budgets[i].Tag = to
+			}
+		}
+	}
+	rules := make([]CategoryRule, 0, len(c.CategoryRules))
+	for _, r := range c.CategoryRules {
+		if isFrom(r.Tag) && to != "" {
+			r.Tag = to
+		}
+		r.Tags, _ = retag(r.Tags, from, to)
+		if r.Category == "" && len(r.Tags) == 0 {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	c.CategoryRules = rules
+}
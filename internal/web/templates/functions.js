@@ -35,14 +35,46 @@ const currencyBehaviors = {
     "myr": { symbol: "RM", useComma: false, useDecimals: true },
 };
 
+// attaches the session's CSRF token to mutating requests and sends signed-out users to the login page
+const nativeFetch = window.fetch.bind(window);
+window.fetch = async (resource, options = {}) => {
+    const method = (options.method || 'GET').toUpperCase();
+    if (!['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+        const headers = new Headers(options.headers || {});
+        headers.set('X-CSRF-Token', getCookie('expenseowl_csrf'));
+        options = { ...options, headers };
+    }
+    const response = await nativeFetch(resource, options);
+    if (response.status === 401 && window.location.pathname !== '/login') {
+        window.location.href = '/login';
+    }
+    return response;
+};
+
+function getCookie(name) {
+    const match = document.cookie.split('; ').find(c => c.startsWith(name + '='));
+    return match ? decodeURIComponent(match.slice(name.length + 1)) : '';
+}
+
 // let currentCurrency = 'usd';
 // let startDate = 1;
 // let currentDate = new Date();
 // let allExpenses = [];
 // let allTags = new Set();
 
+// names of the ledger's tags, registered or carried by expenses
+async function fetchTagNames() {
+    const response = await fetch('/tags');
+    if (!response.ok) throw new Error('Failed to fetch tags');
+    return (await response.json() || []).map(tag => tag.name);
+}
+
 function formatCurrency(amount) {
-    const behavior = currencyBehaviors[currentCurrency] || { symbol: '$', useComma: false, useDecimals: true };
+    return formatCurrencyIn(amount, currentCurrency);
+}
+
+function formatCurrencyIn(amount, currency) {
+    const behavior = currencyBehaviors[currency] || { symbol: '$', useComma: false, useDecimals: true };
     const isNegative = amount < 0;
     const absAmount = Math.abs(amount);
     const options = {
@@ -55,6 +87,21 @@ function formatCurrency(amount) {
     return isNegative ? `-${result}` : result;
 }
 
+// amount converted to the base currency by the server, falling back to the original amount
+function baseAmount(expense) {
+    return typeof expense.baseAmount === 'number' ? expense.baseAmount : expense.amount;
+}
+
+function isForeignCurrency(expense) {
+    return expense.currency && expense.currency !== currentCurrency;
+}
+
+function currencyOptions(selected) {
+    return Object.keys(currencyBehaviors).map(code =>
+        `<option value="${code}" ${code === selected ? 'selected' : ''}>${code.toUpperCase()}</option>`
+    ).join('');
+}
+
 function getUserTimeZone() {
     return Intl.DateTimeFormat().resolvedOptions().timeZone;
 }
@@ -130,12 +177,26 @@ function getMonthBounds(date) {
     }
 }
 
-function getMonthExpenses(expenses) {
-    const { start, end } = getMonthBounds(currentDate);
-    return expenses.filter(exp => {
-        const expDate = new Date(exp.date);
-        return expDate >= start && expDate <= end;
-    }).sort((a, b) => new Date(b.date) - new Date(a.date));
+// one page of expenses from the query endpoint; params are its filters, sort, limit and cursor
+async function fetchExpensePage(params) {
+    const response = await fetch(`/expenses/query?${new URLSearchParams(params)}`);
+    if (!response.ok) throw new Error('Failed to fetch expenses');
+    return response.json();
+}
+
+// every expense in the month of the date, newest first, fetched page by page
+async function fetchMonthExpenses(date) {
+    const { start, end } = getMonthBounds(date);
+    const expenses = [];
+    let cursor = '';
+    do {
+        const params = { from: start.toISOString(), to: end.toISOString(), limit: 1000 };
+        if (cursor) params.cursor = cursor;
+        const page = await fetchExpensePage(params);
+        expenses.push(...page.expenses);
+        cursor = page.nextCursor;
+    } while (cursor);
+    return expenses;
 }
 
 function escapeHTML(str) {
@@ -150,3 +211,74 @@ function escapeHTML(str) {
         }[tag] || tag)
     );
 }
+
+// category and tags of past expenses with a similar name, or null when there are none
+async function fetchSuggestion(name) {
+    if (!name.trim()) return null;
+    const response = await fetch(`/suggest?name=${encodeURIComponent(name)}`);
+    if (!response.ok) return null;
+    const suggestion = await response.json();
+    return suggestion.category ? suggestion : null;
+}
+
+// fills the category, and the tags when none are chosen, of an add-expense form from the
+// suggestion for its name, unless the user already picked a category
+function setupSuggestions(selectedTags, addTag) {
+    const categorySelect = document.getElementById('category');
+    categorySelect.addEventListener('change', () => categorySelect.dataset.chosen = 'true');
+    document.getElementById('name').addEventListener('change', async (e) => {
+        if (categorySelect.dataset.chosen || e.target.form.dataset.editId) return;
+        const suggestion = await fetchSuggestion(e.target.value);
+        if (!suggestion) return;
+        if ([...categorySelect.options].some(o => o.value === suggestion.category)) {
+            categorySelect.value = suggestion.category;
+        }
+        if (selectedTags.size === 0) {
+            suggestion.tags.forEach(addTag);
+        }
+    });
+}
+
+// adds an expense; when the server finds likely duplicates the user is asked before it's added anyway
+async function putExpense(expense) {
+    const request = url => fetch(url, {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(expense)
+    });
+    const response = await request('/expense?checkDuplicates=true');
+    if (response.status !== 409) {
+        return response;
+    }
+    const { duplicates } = await response.clone().json();
+    const existing = duplicates.map(d => `- ${d.expense.name}, ${formatCurrencyIn(d.expense.amount, d.expense.currency)} on ${formatDateFromUTC(d.expense.date)}`);
+    if (!confirm(`This looks like an expense you already have:\n${existing.join('\n')}\n\nAdd it anyway?`)) {
+        return response;
+    }
+    return request('/expense');
+}
+
+// fills the nav-bar ledger selector; the selection is kept in a cookie the server scopes requests by
+async function initLedgerSelect() {
+    const select = document.getElementById('ledgerSelect');
+    if (!select) return;
+    try {
+        const response = await fetch('/ledgers');
+        if (!response.ok) throw new Error('Failed to fetch ledgers');
+        const ledgers = await response.json() || [];
+        const current = getCookie('expenseowl_ledger') || 'default';
+        select.innerHTML = ledgers.map(l => `<option value="${l.id}">${escapeHTML(l.name)}</option>`).join('');
+        select.value = ledgers.some(l => l.id === current) ? current : 'default';
+        select.style.display = ledgers.length > 1 ? '' : 'none';
+        select.addEventListener('change', () => selectLedger(select.value));
+    } catch (error) {
+        console.error('Failed to load ledgers:', error);
+    }
+}
+
+function selectLedger(id) {
+    document.cookie = `expenseowl_ledger=${encodeURIComponent(id)}; path=/; max-age=31536000; SameSite=Lax`;
+    window.location.reload();
+}
+
+document.addEventListener('DOMContentLoaded', initLedgerSelect);